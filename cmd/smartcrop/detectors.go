@@ -0,0 +1,156 @@
+/*
+ * Copyright (c) 2014-2019 Christian Muehlhaeuser
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+ *	Authors:
+ *		Christian Muehlhaeuser <muesli@gmail.com>
+ *		Michael Wendland <michael@michiwend.com>
+ *		Bjørn Erik Pedersen <bjorn.erik.pedersen@gmail.com>
+ *		Patryk Pomykalski <pomyks@gmail.com>
+ */
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/muesli/smartcrop"
+	fd "github.com/muesli/smartcrop/facedetection"
+	"github.com/muesli/smartcrop/faces"
+	"google.golang.org/grpc"
+)
+
+// grpcDetector detects faces with the FaceDetService
+type grpcDetector struct {
+	client fd.FaceDetServiceClient
+}
+
+// DetectFaces implements smartcrop.FaceDetector.
+func (d grpcDetector) DetectFaces(ctx context.Context, img image.Image, data []byte, format string) ([]smartcrop.BoostRegion, error) {
+	if data == nil {
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, img, nil); err != nil {
+			return nil, err
+		}
+		data, format = buf.Bytes(), "jpeg"
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+	resp, err := d.client.Predict(ctx, &fd.FaceDetRequest{
+		ImageData:  data,
+		Type:       format,
+		ConfThresh: 0.4,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var boosts []smartcrop.BoostRegion
+	for _, det := range resp.DetObjs {
+		boosts = append(boosts, smartcrop.BoostRegion{
+			X:      int(det.Lx),
+			Y:      int(det.Ly),
+			Width:  int(det.Rx - det.Lx),
+			Height: int(det.Ry - det.Ly),
+			Weight: 1.0,
+			Shape:  smartcrop.ShapeEllipse,
+		})
+	}
+	return boosts, nil
+}
+
+// newPigoDetector returns the local detector using the pigo cascades
+func newPigoDetector(cascadeFile string, angles []float64, puplocFile string) (*faces.PigoDetector, error) {
+	detector, err := faces.NewPigoDetectorFromFile(cascadeFile)
+	if err != nil {
+		return nil, err
+	}
+	detector.QualityThreshold = qThresh
+	detector.Angles = angles
+	if puplocFile != "" {
+		if err := detector.LoadPuplocFile(puplocFile); err != nil {
+			return nil, err
+		}
+	}
+	return detector, nil
+}
+
+// newFaceDetector returns the chain of the named detectors, "api" or "pigo".
+// The returned function closes their connections.
+func newFaceDetector(names string, angles []float64, puplocFile string) (smartcrop.FaceDetector, func(), error) {
+	var chain faces.Chain
+	var conns []*grpc.ClientConn
+	closeAll := func() {
+		for _, conn := range conns {
+			conn.Close()
+		}
+	}
+
+	for _, name := range strings.Split(names, ",") {
+		switch strings.TrimSpace(name) {
+		case "api":
+			// Set up a connection to the server.
+			conn, err := grpc.Dial(address, grpc.WithInsecure(), grpc.WithBlock())
+			if err != nil {
+				closeAll()
+				return nil, nil, err
+			}
+			conns = append(conns, conn)
+			chain = append(chain, grpcDetector{client: fd.NewFaceDetServiceClient(conn)})
+		case "pigo":
+			d, err := newPigoDetector(cascadeFile, angles, puplocFile)
+			if err != nil {
+				closeAll()
+				return nil, nil, err
+			}
+			chain = append(chain, d)
+		default:
+			closeAll()
+			return nil, nil, fmt.Errorf("unknown face detector %q", name)
+		}
+	}
+
+	if len(chain) == 1 {
+		return chain[0], closeAll, nil
+	}
+	return chain, closeAll, nil
+}
+
+// parseAngles converts a comma separated list of degrees to radians
+func parseAngles(s string) ([]float64, error) {
+	var angles []float64
+	for _, v := range strings.Split(s, ",") {
+		degrees, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil {
+			return nil, err
+		}
+		angles = append(angles, degrees*math.Pi/180)
+	}
+	return angles, nil
+}
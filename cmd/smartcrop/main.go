@@ -29,11 +29,11 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"flag"
 	"fmt"
 	"github.com/disintegration/imaging"
-	"google.golang.org/grpc"
 	"image"
 	"image/jpeg"
 	"image/png"
@@ -41,75 +41,22 @@ import (
 	"io/ioutil"
 	"log"
 	"os"
+	"os/signal"
 	fp "path/filepath"
 	"sync"
 	"time"
 
-	pigo "github.com/esimov/pigo/core"
 	"github.com/muesli/smartcrop"
-	fd "github.com/muesli/smartcrop/facedetection"
 	"github.com/muesli/smartcrop/nfnt"
 )
 
 var (
-	qThresh float32 = 10.0
-	cascadeFile = "./cascade/facefinder"
-	address     = "localhost:50051"
-	defaultName = "face"
+	qThresh     float32 = 10.0
+	cascadeFile         = "./cascade/facefinder"
+	address             = "localhost:50051"
+	defaultName         = "face"
 )
 
-type faceDetFunc func(string) ([]smartcrop.BoostRegion, error)
-
-func loadData(file string) ([]byte, error) {
-	return ioutil.ReadFile(file) // just pass the file name
-}
-
-func faceDetection(file string) ([]smartcrop.BoostRegion, error) {
-	rawImage, err := loadData(file)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "fail to load raw image file:%s", file)
-		return nil, err
-	}
-
-	// Set up a connection to the server.
-	conn, err := grpc.Dial(address, grpc.WithInsecure(), grpc.WithBlock())
-	if err != nil {
-		log.Fatalf("did not connect: %v", err)
-		return nil, err
-	}
-	defer conn.Close()
-
-	c := fd.NewFaceDetServiceClient(conn)
-
-	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
-	defer cancel()
-	request := &fd.FaceDetRequest{
-		ImageData: rawImage,
-		Type: "jpeg",
-		ConfThresh: 0.4,
-	}
-
-	resp, err := c.Predict(ctx, request)
-
-	if err != nil {
-		log.Fatalf("error when predict: %v", err)
-		return nil, err
-	}
-
-	var boosts []smartcrop.BoostRegion
-	for _, det := range resp.DetObjs {
-		boosts = append(boosts, smartcrop.BoostRegion {
-			X: int(det.Lx),
-			Y: int(det.Ly),
-			Width: int(det.Rx - det.Lx),
-			Height: int(det.Ry - det.Ly),
-			Weight: 1.0,
-		})
-	}
-
-	return boosts, err
-}
-
 func main() {
 	input := flag.String("input", "", "input filename")
 	output := flag.String("output", "", "output filename")
@@ -118,8 +65,12 @@ func main() {
 	resize := flag.Bool("resize", true, "resize after cropping")
 	enableCenter := flag.Bool("center", true, "enable auto center crop")
 	faceDetApi := flag.Bool("api", true, "use third-party api to do face detection")
+	detectors := flag.String("detectors", "", "comma separated face detectors to chain: api and pigo, defaults to api or to pigo with -api=false")
 	batchMode := flag.Bool("batch", false, "enable batch mode")
 	quality := flag.Int("quality", 85, "jpeg quality")
+	angles := flag.String("angles", "0", "comma separated rotations in degrees to run the local face detection at, e.g. -30,0,30,90,270")
+	puploc := flag.String("puploc", "", "pigo puploc cascade file, enables boosting the eyes of faces found by the local face detection")
+	timeout := flag.Duration("timeout", 0, "abort cropping an image after this duration in batch mode, 0 disables the limit")
 	flag.Parse()
 
 	if *input == "" {
@@ -127,89 +78,69 @@ func main() {
 		os.Exit(1)
 	}
 
-	if *batchMode {
-		enumerateFolder(*input, *output, *w, *h, *resize, *quality)
-	} else {
+	if *detectors == "" {
+		*detectors = "pigo"
 		if *faceDetApi {
-			cropImage(*input, *output, *w, *h, *resize, *quality, *enableCenter, faceDetection)
-		} else {
-			openCVFaceCall := initOpenCvFaceClassifier(cascadeFile)
-
-			cropImage(*input, *output, *w, *h, *resize, *quality, *enableCenter, openCVFaceCall)
+			*detectors = "api"
 		}
 	}
+	faceAngles, err := parseAngles(*angles)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid angles: %v\n", err)
+		os.Exit(1)
+	}
+	detector, closeDetector, err := newFaceDetector(*detectors, faceAngles, *puploc)
+	if err != nil {
+		log.Fatalf("can't set up face detection: %v", err)
+	}
+	defer closeDetector()
+
+	if *batchMode {
+		// stop processing the remaining images on interrupt
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		interrupt := make(chan os.Signal, 1)
+		signal.Notify(interrupt, os.Interrupt)
+		go func() {
+			<-interrupt
+			fmt.Fprintln(os.Stderr, "interrupted, aborting batch")
+			cancel()
+		}()
+
+		enumerateFolder(ctx, *input, *output, *w, *h, *resize, *quality, *timeout, detector)
+	} else {
+		cropImage(context.Background(), *input, *output, *w, *h, *resize, *quality, *enableCenter, detector)
+	}
 }
 
-func enumerateFolder(inputDir string, outputDir string, w, h int, resize bool, quality int) {
+func enumerateFolder(ctx context.Context, inputDir string, outputDir string, w, h int, resize bool, quality int, timeout time.Duration, detector smartcrop.FaceDetector) {
 	files, err := ioutil.ReadDir(inputDir)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	// Set up a connection to the server.
-	conn, err := grpc.Dial(address, grpc.WithInsecure(), grpc.WithBlock())
-	if err != nil {
-		log.Fatalf("did not connect: %v", err)
-		return
-	}
-	defer conn.Close()
-
-	c := fd.NewFaceDetServiceClient(conn)
-
 	var wg sync.WaitGroup
 	channelCount := 3
 	fileChannels := make([]chan os.FileInfo, channelCount)
 
 	for idx, _ := range fileChannels {
 		fileChannels[idx] = make(chan os.FileInfo)
-		go func(fileChannel <- chan os.FileInfo, jobName string) {
+		go func(fileChannel <-chan os.FileInfo, jobName string) {
 			for file := range fileChannel {
 				ext := fp.Ext(file.Name())
-				if !file.IsDir() && (ext ==".jpg" || ext == ".png" || ext == ".jpeg") {
+				if ctx.Err() == nil && !file.IsDir() && (ext == ".jpg" || ext == ".png" || ext == ".jpeg") {
 					var filename = file.Name()
 					fmt.Fprintf(os.Stdout, "task:%s process:%s\n", jobName, filename)
-					cropImage(inputDir+"/"+filename, outputDir+"/"+filename, w, h, resize, quality, false,
-						func(file string) ([]smartcrop.BoostRegion, error) {
-							rawImage, err := loadData(file)
-							if err != nil {
-								fmt.Fprintf(os.Stderr, "fail to load raw image file:%s", file)
-								return nil, err
-							}
-							request := &fd.FaceDetRequest{
-								ImageData:  rawImage,
-								Type:       "jpeg",
-								ConfThresh: 0.4,
-							}
-							ctx, cancel := context.WithTimeout(context.Background(), time.Hour)
-							defer cancel()
-
-							resp, err := c.Predict(ctx, request)
-
-							if err != nil {
-								log.Fatalf("error when predict: %v", err)
-								return nil, err
-							}
-
-							var boosts []smartcrop.BoostRegion
-							for _, det := range resp.DetObjs {
-								boosts = append(boosts, smartcrop.BoostRegion{
-									X:      int(det.Lx),
-									Y:      int(det.Ly),
-									Width:  int(det.Rx - det.Lx),
-									Height: int(det.Ry - det.Ly),
-									Weight: 1.0,
-								})
-							}
-
-							return boosts, err
-						})
 
+					imgCtx, cancel := withTimeout(ctx, timeout)
+					cropImage(imgCtx, inputDir+"/"+filename, outputDir+"/"+filename, w, h, resize, quality, false, detector)
+					cancel()
 				}
 
 				wg.Done()
 			}
 			fmt.Fprintf(os.Stdout, "job:%s image crop finished\n", jobName)
-		} (fileChannels[idx], fmt.Sprintf("job_%d", idx))
+		}(fileChannels[idx], fmt.Sprintf("job_%d", idx))
 	}
 
 	for idx, file := range files {
@@ -217,7 +148,7 @@ func enumerateFolder(inputDir string, outputDir string, w, h int, resize bool, q
 		fileChannels[idx%len(fileChannels)] <- file
 	}
 
-	for _, fileChannel :=  range fileChannels {
+	for _, fileChannel := range fileChannels {
 		close(fileChannel)
 	}
 
@@ -225,102 +156,45 @@ func enumerateFolder(inputDir string, outputDir string, w, h int, resize bool, q
 	fmt.Println("wait for image process task to finish")
 }
 
-func initOpenCvFaceClassifier(cascadeFile string) func(file string) ([]smartcrop.BoostRegion, error) {
-	cascadeBytes, err := ioutil.ReadFile(cascadeFile)
-	if err != nil {
-		return nil
-	}
-
-	p := pigo.NewPigo()
-	// Unpack the binary file. This will return the number of cascade trees,
-	// the tree depth, the threshold and the prediction from tree's leaf nodes.
-	classifier, err := p.Unpack(cascadeBytes)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "fail to load cascade file:%s", cascadeFile)
-		return nil
-	}
-
-	openCvFace := func(file string) ([]smartcrop.BoostRegion, error) {
-		f, err := os.Open(file)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "can't open input file: %v\n", err)
-			os.Exit(1)
-		}
-		defer f.Close()
-
-		img, _, err := image.Decode(f)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "can't decode input file: %v\n", err)
-			return nil, err
-		}
-
-		faces := faceDet(img, classifier)
-
-		// convert dets into boost region
-		var boosts []smartcrop.BoostRegion
-		for _, face := range faces {
-			if face.Q > qThresh {
-				boosts = append(boosts, smartcrop.BoostRegion {
-					X: face.Col - face.Scale/2,
-					Y: face.Row -face.Scale/2,
-					Width: face.Scale,
-					Height: face.Scale,
-					Weight: 1.0,
-				})
-			}
-		}
-
-		return boosts, nil
-	}
-
-	return openCvFace
-}
-
-func faceDet(src image.Image, classifier *pigo.Pigo) []pigo.Detection  {
-	pixels := pigo.RgbToGrayscale(src)
-	cols, rows := src.Bounds().Max.X, src.Bounds().Max.Y
-
-	cParams := pigo.CascadeParams{
-		MinSize:     20,
-		MaxSize:     1000,
-		ShiftFactor: 0.1,
-		ScaleFactor: 1.1,
-
-		ImageParams: pigo.ImageParams{
-			Pixels: pixels,
-			Rows:   rows,
-			Cols:   cols,
-			Dim:    cols,
-		},
+// withTimeout limits the context to the given duration, unless it's zero
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
 	}
-
-	angle := 0.0 // cascade rotation angle. 0.0 is 0 radians and 1.0 is 2*pi radians
-
-	// Run the classifier over the obtained leaf nodes and return the detection results.
-	// The result contains quadruplets representing the row, column, scale and detection score.
-	dets := classifier.RunCascade(cParams, angle)
-
-	// Calculate the intersection over union (IoU) of two clusters.
-	dets = classifier.ClusterDetections(dets, 0.2)
-
-	return dets
+	return context.WithTimeout(ctx, timeout)
 }
 
-func cropImage(input string, output string, w, h int, resize bool, quality int, enableCenter bool, faceCall faceDetFunc) {
-	f, err := os.Open(input)
+func cropImage(ctx context.Context, input string, output string, w, h int, resize bool, quality int, enableCenter bool, detector smartcrop.FaceDetector) {
+	data, err := ioutil.ReadFile(input)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "can't open input file: %v\n", err)
 		os.Exit(1)
 	}
-	defer f.Close()
 
-	img, format, err := image.Decode(f)
+	img, format, err := image.Decode(bytes.NewReader(data))
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "can't decode input file: %v\n", err)
 		os.Exit(1)
 	}
 
-	boosts, err := faceCall(input)
+	boosts, err := detector.DetectFaces(ctx, img, data, format)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "face detection failed for %s, cropping with the %d regions found: %v\n", input, len(boosts), err)
+	}
+
+	oriRatio := float64(img.Bounds().Dx()) / float64(img.Bounds().Dy())
+	wantRatio := float64(w) / float64(h)
+
+	var cbImg image.Image
+	if enableCenter && oriRatio >= wantRatio && oriRatio <= wantRatio*1.4 {
+		cbImg = centerCrop(img, w, h, 100.0, resize)
+	} else {
+		cbImg, err = crop(ctx, img, w, h, resize, boosts)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "can't crop input file %s: %v\n", input, err)
+			return
+		}
+	}
 
 	out := output
 	var fOut io.WriteCloser
@@ -335,16 +209,6 @@ func cropImage(input string, output string, w, h int, resize bool, quality int,
 		defer fOut.Close()
 	}
 
-	oriRatio := float64(img.Bounds().Dx()) / float64(img.Bounds().Dy())
-	wantRatio := float64(w) / float64(h)
-
-	var cbImg image.Image
-	if enableCenter && oriRatio >= wantRatio && oriRatio <= wantRatio * 1.4 {
-		cbImg = centerCrop(img, w, h, 100.0, resize)
-	} else {
-		cbImg = crop(img, w, h, resize, boosts)
-	}
-
 	// var imageList []*image.RGBA
 	// imageList = append(imageList, smartcrop.ToRGBA(img))
 	// newImg := crop(img, w, h, resize, boosts)
@@ -359,11 +223,14 @@ func cropImage(input string, output string, w, h int, resize bool, quality int,
 	}
 }
 
-func crop(img image.Image, w, h int, resize bool, boosts []smartcrop.BoostRegion) image.Image {
+func crop(ctx context.Context, img image.Image, w, h int, resize bool, boosts []smartcrop.BoostRegion) (image.Image, error) {
 	width, height := getCropDimensions(img, w, h)
 	resizer := nfnt.NewDefaultResizer()
-	analyzer := smartcrop.NewAnalyzer(resizer)
-	topCrop, _ := analyzer.FindBestCrop(img, width, height, boosts)
+	analyzer := smartcrop.NewAnalyzerWithOptions(resizer, smartcrop.Logger{}, smartcrop.DefaultOptions())
+	topCrop, err := analyzer.FindBestCropContext(ctx, img, width, height, boosts)
+	if err != nil {
+		return nil, err
+	}
 
 	type SubImager interface {
 		SubImage(r image.Rectangle) image.Image
@@ -373,7 +240,7 @@ func crop(img image.Image, w, h int, resize bool, boosts []smartcrop.BoostRegion
 	if resize && (img.Bounds().Dx() != width || img.Bounds().Dy() != height) {
 		img = resizer.Resize(img, uint(width), uint(height))
 	}
-	return img
+	return img, nil
 }
 
 func getCropDimensions(img image.Image, width, height int) (int, int) {
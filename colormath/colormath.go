@@ -0,0 +1,162 @@
+/*
+ * Copyright (c) 2014-2017 Christian Muehlhaeuser
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+ *	Authors:
+ *		Christian Muehlhaeuser <muesli@gmail.com>
+ *		Michael Wendland <michael@michiwend.com>
+ *		Bjørn Erik Pedersen <bjorn.erik.pedersen@gmail.com>
+ */
+
+// Package colormath implements the color conversions used by the feature
+// detection: sRGB linearization, relative luminance, HSL, HSV and CIELAB.
+package colormath
+
+import (
+	"math"
+)
+
+// D65 reference white in XYZ
+const (
+	whiteX = 0.95047
+	whiteY = 1.0
+	whiteZ = 1.08883
+)
+
+// linear maps 8 bit sRGB components to linear light
+var linear [256]float64
+
+func init() {
+	for i := range linear {
+		linear[i] = SRGBToLinear(float64(i) / 255)
+	}
+}
+
+// SRGBToLinear converts a gamma encoded sRGB component (0..1) to linear light.
+func SRGBToLinear(v float64) float64 {
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+// LinearToSRGB converts a linear light component (0..1) to gamma encoded sRGB.
+func LinearToSRGB(v float64) float64 {
+	if v <= 0.0031308 {
+		return v * 12.92
+	}
+	return 1.055*math.Pow(v, 1/2.4) - 0.055
+}
+
+// Luminance returns the relative luminance (0..1) of an sRGB color, weighting
+// the linear components with the Rec. 709 coefficients.
+func Luminance(r, g, b uint8) float64 {
+	return 0.2126*linear[r] + 0.7152*linear[g] + 0.0722*linear[b]
+}
+
+// RGBToXYZ converts an sRGB color to CIE XYZ (D65), Y being the luminance.
+func RGBToXYZ(r, g, b uint8) (x, y, z float64) {
+	lr, lg, lb := linear[r], linear[g], linear[b]
+	x = 0.4124564*lr + 0.3575761*lg + 0.1804375*lb
+	y = 0.2126729*lr + 0.7151522*lg + 0.0721750*lb
+	z = 0.0193339*lr + 0.1191920*lg + 0.9503041*lb
+	return x, y, z
+}
+
+// labF is the nonlinearity of the CIELAB conversion
+func labF(t float64) float64 {
+	const delta = 6.0 / 29.0
+	if t > delta*delta*delta {
+		return math.Cbrt(t)
+	}
+	return t/(3*delta*delta) + 4.0/29.0
+}
+
+// XYZToLab converts CIE XYZ (D65) to CIELAB, with the lightness L in 0..100.
+func XYZToLab(x, y, z float64) (l, a, b float64) {
+	fx, fy, fz := labF(x/whiteX), labF(y/whiteY), labF(z/whiteZ)
+	return 116*fy - 16, 500 * (fx - fy), 200 * (fy - fz)
+}
+
+// RGBToLab converts an sRGB color to CIELAB, with the lightness L in 0..100.
+func RGBToLab(r, g, b uint8) (l, a, bb float64) {
+	return XYZToLab(RGBToXYZ(r, g, b))
+}
+
+// LabSaturation returns the CIE saturation (0..1) of a CIELAB color, its
+// chroma relative to its colorfulness and lightness.
+func LabSaturation(l, a, b float64) float64 {
+	c := math.Hypot(a, b)
+	if c == 0 {
+		return 0
+	}
+	return c / math.Hypot(c, l)
+}
+
+// hue returns the hue in degrees (0..360) of the components (0..1)
+func hue(r, g, b, max, d float64) float64 {
+	if d == 0 {
+		return 0
+	}
+
+	var h float64
+	switch max {
+	case r:
+		h = math.Mod((g-b)/d, 6)
+	case g:
+		h = (b-r)/d + 2
+	default:
+		h = (r-g)/d + 4
+	}
+	h *= 60
+	if h < 0 {
+		h += 360
+	}
+	return h
+}
+
+// RGBToHSL converts gamma encoded RGB to hue (0..360), saturation (0..1) and
+// lightness (0..1).
+func RGBToHSL(r, g, b uint8) (h, s, l float64) {
+	rf, gf, bf := float64(r)/255, float64(g)/255, float64(b)/255
+	max := math.Max(rf, math.Max(gf, bf))
+	min := math.Min(rf, math.Min(gf, bf))
+	d := max - min
+
+	l = (max + min) / 2
+	if d != 0 {
+		s = d / (1 - math.Abs(2*l-1))
+	}
+	return hue(rf, gf, bf, max, d), s, l
+}
+
+// RGBToHSV converts gamma encoded RGB to hue (0..360), saturation (0..1) and
+// value (0..1).
+func RGBToHSV(r, g, b uint8) (h, s, v float64) {
+	rf, gf, bf := float64(r)/255, float64(g)/255, float64(b)/255
+	max := math.Max(rf, math.Max(gf, bf))
+	min := math.Min(rf, math.Min(gf, bf))
+	d := max - min
+
+	if max != 0 {
+		s = d / max
+	}
+	return hue(rf, gf, bf, max, d), s, max
+}
@@ -0,0 +1,130 @@
+/*
+ * Copyright (c) 2014-2017 Christian Muehlhaeuser
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+ *	Authors:
+ *		Christian Muehlhaeuser <muesli@gmail.com>
+ *		Michael Wendland <michael@michiwend.com>
+ *		Bjørn Erik Pedersen <bjorn.erik.pedersen@gmail.com>
+ */
+
+package colormath
+
+import (
+	"math"
+	"testing"
+)
+
+type rgb struct{ r, g, b uint8 }
+
+func near(a, b, tolerance float64) bool {
+	return math.Abs(a-b) <= tolerance
+}
+
+func TestLinear(t *testing.T) {
+	tests := []struct {
+		srgb, linear float64
+	}{
+		{0, 0},
+		{0.04045, 0.0031308},
+		{0.5, 0.2140411},
+		{1, 1},
+	}
+	for _, test := range tests {
+		if v := SRGBToLinear(test.srgb); !near(v, test.linear, 1e-6) {
+			t.Errorf("SRGBToLinear(%f): expected %f, got %f", test.srgb, test.linear, v)
+		}
+		if v := LinearToSRGB(test.linear); !near(v, test.srgb, 1e-6) {
+			t.Errorf("LinearToSRGB(%f): expected %f, got %f", test.linear, test.srgb, v)
+		}
+	}
+}
+
+func TestLuminance(t *testing.T) {
+	tests := []struct {
+		c rgb
+		y float64
+	}{
+		{rgb{0, 0, 0}, 0},
+		{rgb{255, 255, 255}, 1},
+		{rgb{255, 0, 0}, 0.2126},
+		{rgb{0, 255, 0}, 0.7152},
+		{rgb{0, 0, 255}, 0.0722},
+		{rgb{128, 128, 128}, 0.2158605},
+	}
+	for _, test := range tests {
+		if y := Luminance(test.c.r, test.c.g, test.c.b); !near(y, test.y, 1e-6) {
+			t.Errorf("%v: expected %f, got %f", test.c, test.y, y)
+		}
+	}
+}
+
+func TestLab(t *testing.T) {
+	tests := []struct {
+		c       rgb
+		l, a, b float64
+	}{
+		{rgb{0, 0, 0}, 0, 0, 0},
+		{rgb{255, 255, 255}, 100, 0, 0},
+		{rgb{128, 128, 128}, 53.585, 0, 0},
+		{rgb{255, 0, 0}, 53.241, 80.092, 67.203},
+		{rgb{0, 255, 0}, 87.735, -86.183, 83.179},
+		{rgb{0, 0, 255}, 32.297, 79.188, -107.860},
+	}
+	for _, test := range tests {
+		l, a, b := RGBToLab(test.c.r, test.c.g, test.c.b)
+		if !near(l, test.l, 0.01) || !near(a, test.a, 0.01) || !near(b, test.b, 0.01) {
+			t.Errorf("%v: expected %.3f %.3f %.3f, got %.3f %.3f %.3f", test.c, test.l, test.a, test.b, l, a, b)
+		}
+	}
+
+	if s := LabSaturation(50, 0, 0); s != 0 {
+		t.Errorf("expected gray to be unsaturated, got %f", s)
+	}
+	if s := LabSaturation(RGBToLab(255, 0, 0)); !near(s, 0.8914, 1e-3) {
+		t.Errorf("expected red to be saturated, got %f", s)
+	}
+}
+
+func TestHSLAndHSV(t *testing.T) {
+	tests := []struct {
+		c               rgb
+		h, sl, l, sv, v float64
+	}{
+		{rgb{0, 0, 0}, 0, 0, 0, 0, 0},
+		{rgb{255, 255, 255}, 0, 0, 1, 0, 1},
+		{rgb{255, 0, 0}, 0, 1, 0.5, 1, 1},
+		{rgb{255, 255, 0}, 60, 1, 0.5, 1, 1},
+		{rgb{0, 128, 0}, 120, 1, 0.25098, 1, 0.50196},
+		{rgb{0, 255, 255}, 180, 1, 0.5, 1, 1},
+		{rgb{255, 0, 255}, 300, 1, 0.5, 1, 1},
+		{rgb{191, 64, 64}, 0, 0.49804, 0.5, 0.66492, 0.74902},
+	}
+	for _, test := range tests {
+		h, s, l := RGBToHSL(test.c.r, test.c.g, test.c.b)
+		if !near(h, test.h, 1e-3) || !near(s, test.sl, 1e-3) || !near(l, test.l, 1e-3) {
+			t.Errorf("HSL %v: expected %.3f %.3f %.3f, got %.3f %.3f %.3f", test.c, test.h, test.sl, test.l, h, s, l)
+		}
+		h, s, v := RGBToHSV(test.c.r, test.c.g, test.c.b)
+		if !near(h, test.h, 1e-3) || !near(s, test.sv, 1e-3) || !near(v, test.v, 1e-3) {
+			t.Errorf("HSV %v: expected %.3f %.3f %.3f, got %.3f %.3f %.3f", test.c, test.h, test.sv, test.v, h, s, v)
+		}
+	}
+}
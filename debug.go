@@ -47,6 +47,12 @@ func debugOutput(debug bool, img *image.RGBA, debugType string) {
 	}
 }
 
+func debugPlane(debug bool, p *Plane, debugType string) {
+	if debug {
+		writeImage("png", p.gray(), "./smartcrop_"+debugType+".png")
+	}
+}
+
 func writeImage(imgtype string, img image.Image, name string) error {
 	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
 		panic(err)
@@ -82,7 +88,9 @@ func writeImageToPng(img image.Image, name string) error {
 	return png.Encode(fso, img)
 }
 
-func drawDebugCrop(topCrop Crop, o *image.RGBA) {
+// drawDebugCrop visualizes the importance of the crop, penalty regions get
+// painted magenta
+func drawDebugCrop(opts *Options, topCrop Crop, o *image.RGBA, penalty *Plane) {
 	width := o.Bounds().Dx()
 	height := o.Bounds().Dy()
 
@@ -91,9 +99,9 @@ func drawDebugCrop(topCrop Crop, o *image.RGBA) {
 			r, g, b, _ := o.At(x, y).RGBA()
 			r8 := float64(r >> 8)
 			g8 := float64(g >> 8)
-			b8 := uint8(b >> 8)
+			b8 := float64(b >> 8)
 
-			imp, _ := importance(topCrop, x, y)
+			imp, _ := importance(opts, topCrop, x, y)
 
 			if imp > 0 {
 				g8 += imp * 32
@@ -101,7 +109,13 @@ func drawDebugCrop(topCrop Crop, o *image.RGBA) {
 				r8 += imp * -64
 			}
 
-			nc := color.RGBA{uint8(bounds(r8)), uint8(bounds(g8)), b8, 255}
+			if penalty != nil {
+				p := float64(penalty.At(x, y)) * 255
+				r8 += p
+				b8 += p
+			}
+
+			nc := color.RGBA{uint8(bounds(r8)), uint8(bounds(g8)), uint8(bounds(b8)), 255}
 			o.SetRGBA(x, y, nc)
 		}
 	}
@@ -0,0 +1,185 @@
+/*
+ * Copyright (c) 2014-2017 Christian Muehlhaeuser
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+ *	Authors:
+ *		Christian Muehlhaeuser <muesli@gmail.com>
+ *		Michael Wendland <michael@michiwend.com>
+ *		Bjørn Erik Pedersen <bjorn.erik.pedersen@gmail.com>
+ */
+
+package smartcrop
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"math"
+	"strings"
+)
+
+// Plane is a single feature channel with one value per pixel, usually in the
+// range 0..1, stored row by row
+type Plane struct {
+	Width  int
+	Height int
+	Pix    []float32
+}
+
+// NewPlane returns an empty plane of the given size
+func NewPlane(width, height int) *Plane {
+	return &Plane{Width: width, Height: height, Pix: make([]float32, width*height)}
+}
+
+// At returns the value at x, y
+func (p *Plane) At(x, y int) float32 {
+	return p.Pix[y*p.Width+x]
+}
+
+// Set sets the value at x, y
+func (p *Plane) Set(x, y int, v float32) {
+	p.Pix[y*p.Width+x] = v
+}
+
+// Bounds returns the plane's bounds, which always start at the origin
+func (p *Plane) Bounds() image.Rectangle {
+	return image.Rect(0, 0, p.Width, p.Height)
+}
+
+// gray converts the plane for debug output
+func (p *Plane) gray() *image.Gray {
+	o := image.NewGray(image.Rect(0, 0, p.Width, p.Height))
+	for i, v := range p.Pix {
+		o.Pix[i] = uint8(bounds(float64(v) * 255))
+	}
+	return o
+}
+
+// Detector computes a feature plane from the prescaled image. Detectors set
+// in Options.Detectors contribute their plane, multiplied by the importance
+// and their weight, to the total score of a crop.
+type Detector interface {
+	// Name identifies the detector, e.g. in the debug output
+	Name() string
+	// Weight of the detector's term in the total score
+	Weight() float64
+	// Detect returns a plane with the same size as the image
+	Detect(img *image.RGBA) (*Plane, error)
+}
+
+// FaceDetector finds faces in an image and returns them as boost regions in
+// its coordinates. The analyzer runs it on the prescaled image and passes
+// its context along; it can only return early on cancellation if the
+// detector honours the context. The faces package has a pure Go
+// implementation.
+type FaceDetector interface {
+	// DetectFaces gets the decoded image and, if available, its encoded data
+	// and format, e.g. the file it was decoded from, which spares detectors
+	// sending the image to a service from encoding it again. The analyzer
+	// passes nil and "". Detectors that fail after finding some of the
+	// faces return them along with FaceErrors.
+	DetectFaces(ctx context.Context, img image.Image, data []byte, format string) ([]BoostRegion, error)
+}
+
+// FaceErrors collects the errors of face detectors, e.g. the ones of a
+// faces.Chain that still found faces with its other detectors. The analyzer
+// keeps the faces returned along with FaceErrors and logs the errors.
+type FaceErrors []error
+
+func (e FaceErrors) Error() string {
+	msgs := make([]string, len(e))
+	for idx, err := range e {
+		msgs[idx] = err.Error()
+	}
+	return "Face detection failed: " + strings.Join(msgs, "; ")
+}
+
+// Unwrap returns the single errors.
+func (e FaceErrors) Unwrap() []error {
+	return e
+}
+
+// edgeDetector, skinDetector and saturationDetector are the built-in
+// detectors of the detail, skin and saturation planes
+type edgeDetector struct{ opts *Options }
+type skinDetector struct{ opts *Options }
+type saturationDetector struct{ opts *Options }
+
+func (d edgeDetector) Name() string    { return "edge" }
+func (d edgeDetector) Weight() float64 { return d.opts.DetailWeight }
+func (d edgeDetector) Detect(img *image.RGBA) (*Plane, error) {
+	return edgeDetect(d.opts, img), nil
+}
+
+func (d skinDetector) Name() string    { return "skin" }
+func (d skinDetector) Weight() float64 { return d.opts.SkinWeight }
+func (d skinDetector) Detect(img *image.RGBA) (*Plane, error) {
+	return skinDetect(d.opts, img), nil
+}
+
+func (d saturationDetector) Name() string    { return "saturation" }
+func (d saturationDetector) Weight() float64 { return d.opts.SaturationWeight }
+func (d saturationDetector) Detect(img *image.RGBA) (*Plane, error) {
+	return saturationDetect(d.opts, img), nil
+}
+
+// detect runs the detector and checks the size of its plane
+func detect(d Detector, img *image.RGBA) (*Plane, error) {
+	p, err := d.Detect(img)
+	if err != nil {
+		return nil, err
+	}
+	if p == nil || p.Width != img.Bounds().Dx() || p.Height != img.Bounds().Dy() || len(p.Pix) != p.Width*p.Height {
+		return nil, fmt.Errorf("Detector %s returned a plane not matching the %dx%d image", d.Name(), img.Bounds().Dx(), img.Bounds().Dy())
+	}
+	return p, nil
+}
+
+// addPlane adds the weighted plane to the sum
+func addPlane(sum, p *Plane, weight float64) {
+	for i, v := range p.Pix {
+		sum.Pix[i] += v * float32(weight)
+	}
+}
+
+// downSamplePlane reduces factor x factor blocks of the plane to a blend of
+// their average and their maximum, weighted by maxRatio
+func downSamplePlane(input *Plane, factor int, maxRatio float64) *Plane {
+	width := input.Width / factor
+	height := input.Height / factor
+	output := NewPlane(width, height)
+	ifactor2 := 1 / float64(factor*factor)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			// accumulate in float64, large factors would lose precision
+			var sum float64
+			peak := math.Inf(-1)
+			for v := 0; v < factor; v++ {
+				for u := 0; u < factor; u++ {
+					c := float64(input.At(x*factor+u, y*factor+v))
+					sum += c
+					peak = math.Max(peak, c)
+				}
+			}
+			output.Set(x, y, float32(sum*ifactor2*(1-maxRatio)+peak*maxRatio))
+		}
+	}
+	return output
+}
@@ -0,0 +1,182 @@
+/*
+ * Copyright (c) 2014-2017 Christian Muehlhaeuser
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+ *	Authors:
+ *		Christian Muehlhaeuser <muesli@gmail.com>
+ *		Michael Wendland <michael@michiwend.com>
+ *		Bjørn Erik Pedersen <bjorn.erik.pedersen@gmail.com>
+ */
+
+package smartcrop
+
+import (
+	"context"
+	"errors"
+	"image"
+	"math"
+	"testing"
+
+	"github.com/muesli/smartcrop/nfnt"
+)
+
+// regionDetector marks everything right of the given relative position
+type regionDetector struct {
+	from   float64
+	weight float64
+	width  int
+}
+
+func (d regionDetector) Name() string    { return "region" }
+func (d regionDetector) Weight() float64 { return d.weight }
+func (d regionDetector) Detect(img *image.RGBA) (*Plane, error) {
+	width := d.width
+	if width == 0 {
+		width = img.Bounds().Dx()
+	}
+	p := NewPlane(width, img.Bounds().Dy())
+	for y := 0; y < p.Height; y++ {
+		for x := int(d.from * float64(p.Width)); x < p.Width; x++ {
+			p.Set(x, y, 1)
+		}
+	}
+	return p, nil
+}
+
+// staticFaces finds the same faces, given for an image of the original size,
+// in every image it gets and records the size of the last one
+type staticFaces struct {
+	original image.Rectangle
+	faces    []BoostRegion
+	err      error
+	seen     *image.Rectangle
+}
+
+func (d staticFaces) DetectFaces(ctx context.Context, img image.Image, data []byte, format string) ([]BoostRegion, error) {
+	if d.seen != nil {
+		*d.seen = img.Bounds()
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	f := float64(img.Bounds().Dx()) / float64(d.original.Dx())
+	faces := make([]BoostRegion, len(d.faces))
+	for idx, face := range d.faces {
+		face.X = int(float64(face.X-d.original.Min.X)*f) + img.Bounds().Min.X
+		face.Y = int(float64(face.Y-d.original.Min.Y)*f) + img.Bounds().Min.Y
+		face.Width = int(float64(face.Width) * f)
+		face.Height = int(float64(face.Height) * f)
+		faces[idx] = face
+	}
+	return faces, nil
+}
+
+func TestDetectors(t *testing.T) {
+	img := loadTestImage(t, testFile)
+
+	opts := DefaultOptions()
+	opts.Detectors = []Detector{regionDetector{from: 0.75, weight: 1.0}}
+	for _, integral := range []bool{false, true} {
+		opts.IntegralScoring = integral
+		analyzer := NewAnalyzerWithOptions(nfnt.NewDefaultResizer(), Logger{}, opts)
+		topCrop, err := analyzer.FindBestCropWithScore(img, 250, 250, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if topCrop.Max.X < 800 {
+			t.Errorf("expected crop %v to move towards the detected area", topCrop.Rectangle)
+		}
+		if topCrop.Score.Extra <= 0 {
+			t.Errorf("expected a positive detector score, got %f", topCrop.Score.Extra)
+		}
+	}
+
+	// the detector planes survive encoding
+	analyzer := NewAnalyzerWithOptions(nfnt.NewDefaultResizer(), Logger{}, opts)
+	fm, err := analyzer.NewFeatureMap(img, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := fm.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cached FeatureMap
+	if err := cached.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if cached.Extra == nil || cached.Extra.At(fm.Extra.Width-1, 0) != 1 || cached.Extra.At(0, 0) != 0 {
+		t.Errorf("expected the detector plane to survive encoding")
+	}
+
+	opts.Detectors = []Detector{regionDetector{from: 0.75, weight: 1.0, width: 10}}
+	analyzer = NewAnalyzerWithOptions(nfnt.NewDefaultResizer(), Logger{}, opts)
+	if _, err := analyzer.FindBestCrop(img, 250, 250, nil); err == nil {
+		t.Errorf("expected an error for a plane of the wrong size")
+	}
+}
+
+func TestFaceDetector(t *testing.T) {
+	img := loadTestImage(t, testFile)
+
+	var seen image.Rectangle
+	opts := DefaultOptions()
+	opts.FaceDetector = staticFaces{
+		original: img.Bounds(),
+		faces:    []BoostRegion{{X: 700, Y: 50, Width: 100, Height: 100, Weight: 1.0}},
+		seen:     &seen,
+	}
+	analyzer := NewAnalyzerWithOptions(nfnt.NewDefaultResizer(), Logger{}, opts)
+	boosts := []BoostRegion{{X: 0, Y: 0, Width: 10, Height: 10, Weight: 0.1}}
+	topCrop, err := analyzer.FindBestCropWithScore(img, 250, 250, boosts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !image.Rect(700, 50, 800, 150).In(topCrop.Rectangle) {
+		t.Errorf("expected crop %v to contain the face", topCrop.Rectangle)
+	}
+	if len(boosts) != 1 || cap(boosts) != 1 {
+		t.Errorf("expected the caller's boosts to stay untouched, got %v", boosts)
+	}
+	// the detector runs on the prescaled image
+	if seen.Min != (image.Point{}) || math.Min(float64(seen.Dx()), float64(seen.Dy())) != opts.PrescaleMin {
+		t.Errorf("expected the prescaled image, got %v", seen)
+	}
+
+	// required faces get scaled back to the original image
+	opts.FaceDetector = staticFaces{
+		original: img.Bounds(),
+		faces:    []BoostRegion{{X: 700, Y: 50, Width: 100, Height: 100, Required: true}},
+	}
+	fm, err := NewAnalyzerWithOptions(nfnt.NewDefaultResizer(), Logger{}, opts).NewFeatureMap(img, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !fm.Required.In(image.Rect(690, 40, 810, 160)) || !image.Rect(710, 60, 790, 140).In(fm.Required) {
+		t.Errorf("expected the required face around %v, got %v", image.Rect(700, 50, 800, 150), fm.Required)
+	}
+
+	errFaces := errors.New("no faces today")
+	opts.FaceDetector = staticFaces{err: errFaces}
+	analyzer = NewAnalyzerWithOptions(nfnt.NewDefaultResizer(), Logger{}, opts)
+	if _, err := analyzer.FindBestCrop(img, 250, 250, nil); err != errFaces {
+		t.Errorf("expected %v, got %v", errFaces, err)
+	}
+}
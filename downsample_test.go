@@ -0,0 +1,178 @@
+/*
+ * Copyright (c) 2014-2017 Christian Muehlhaeuser
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+ *	Authors:
+ *		Christian Muehlhaeuser <muesli@gmail.com>
+ *		Michael Wendland <michael@michiwend.com>
+ *		Bjørn Erik Pedersen <bjorn.erik.pedersen@gmail.com>
+ */
+
+package smartcrop
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"image/draw"
+	"io/ioutil"
+	"log"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// referenceDownSample is a straightforward version of downSamplePlane
+func referenceDownSample(p *Plane, factor int, maxRatio float64) [][]float64 {
+	res := make([][]float64, p.Height/factor)
+	for y := range res {
+		res[y] = make([]float64, p.Width/factor)
+		for x := range res[y] {
+			var values []float64
+			for v := 0; v < factor; v++ {
+				for u := 0; u < factor; u++ {
+					values = append(values, float64(p.Pix[(y*factor+v)*p.Width+x*factor+u]))
+				}
+			}
+
+			sum, peak := 0.0, values[0]
+			for _, value := range values {
+				sum += value
+				peak = math.Max(peak, value)
+			}
+			res[y][x] = sum/float64(len(values))*(1-maxRatio) + peak*maxRatio
+		}
+	}
+	return res
+}
+
+func TestDownSample(t *testing.T) {
+	// bright blocks used to wrap around in uint8 sums
+	bright := NewPlane(8, 8)
+	for i := range bright.Pix {
+		bright.Pix[i] = 1
+	}
+	// a single detail pixel in every block
+	sparse := NewPlane(8, 8)
+	sparse.Set(0, 0, 1)
+	sparse.Set(5, 2, 1)
+	sparse.Set(3, 7, 1)
+	sparse.Set(6, 6, 1)
+
+	tests := []struct {
+		plane    *Plane
+		maxRatio float64
+		expected float32
+	}{
+		{bright, 0, 1},
+		{bright, 0.3, 1},
+		{bright, 1, 1},
+		{sparse, 0, 1.0 / 16},
+		{sparse, 0.3, 0.7/16 + 0.3},
+		{sparse, 0.5, 0.5/16 + 0.5},
+		{sparse, 1, 1},
+	}
+	for _, test := range tests {
+		sample := downSamplePlane(test.plane, 4, test.maxRatio)
+		if sample.Width != 2 || sample.Height != 2 {
+			t.Fatalf("expected a 2x2 plane, got %dx%d", sample.Width, sample.Height)
+		}
+		for _, v := range sample.Pix {
+			if math.Abs(float64(v-test.expected)) > 1e-6 {
+				t.Errorf("max ratio %.1f: expected %f, got %f", test.maxRatio, test.expected, v)
+			}
+		}
+	}
+
+	// random planes with odd sizes match the reference computation
+	rnd := rand.New(rand.NewSource(1))
+	fm := &FeatureMap{}
+	for _, p := range []**Plane{&fm.Detail, &fm.Skin, &fm.Saturation, &fm.Boost} {
+		*p = NewPlane(37, 22)
+		for i := range (*p).Pix {
+			(*p).Pix[i] = rnd.Float32()
+		}
+	}
+	opts := DefaultOptions()
+	opts.SkinMaxRatio = 0.8
+	for _, factor := range []int{1, 2, 4, 8} {
+		opts.ScoreDownSample = factor
+		sample := downSample(&opts, fm)
+		for _, plane := range []struct {
+			name     string
+			input    *Plane
+			output   *Plane
+			maxRatio float64
+		}{
+			{"detail", fm.Detail, sample.detail, opts.DetailMaxRatio},
+			{"skin", fm.Skin, sample.skin, opts.SkinMaxRatio},
+			{"saturation", fm.Saturation, sample.saturation, opts.SaturationMaxRatio},
+			{"boost", fm.Boost, sample.boost, 0},
+		} {
+			expected := referenceDownSample(plane.input, factor, plane.maxRatio)
+			if plane.output.Height != len(expected) || plane.output.Width != len(expected[0]) {
+				t.Fatalf("%s: expected %dx%d, got %dx%d", plane.name, len(expected[0]), len(expected), plane.output.Width, plane.output.Height)
+			}
+			for y := range expected {
+				for x := range expected[y] {
+					if v := float64(plane.output.At(x, y)); math.Abs(v-expected[y][x]) > 1e-5 {
+						t.Errorf("%s factor %d at %d,%d: expected %f, got %f", plane.name, factor, x, y, expected[y][x], v)
+					}
+				}
+			}
+		}
+	}
+
+	opts = DefaultOptions()
+	opts.DetailMaxRatio = 1.5
+	if err := opts.validate(); err != ErrInvalidOptions {
+		t.Errorf("expected %v, got %v", ErrInvalidOptions, err)
+	}
+}
+
+func TestDownSampleBrightImage(t *testing.T) {
+	// a uniform, bright and saturated image, whose 4x4 block sums used to
+	// overflow the uint8 accumulators
+	img := image.NewRGBA(image.Rect(0, 0, 64, 64))
+	draw.Draw(img, img.Bounds(), &image.Uniform{color.RGBA{240, 170, 130, 255}}, image.ZP, draw.Src)
+
+	opts := DefaultOptions()
+	logger := Logger{Log: log.New(ioutil.Discard, "", 0)}
+	fm, err := analyse(context.Background(), logger, &opts, img, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sample := downSample(&opts, fm)
+	for _, plane := range []struct {
+		name          string
+		input, output *Plane
+	}{
+		{"skin", fm.Skin, sample.skin},
+		{"saturation", fm.Saturation, sample.saturation},
+	} {
+		expected := plane.input.At(32, 32)
+		if expected <= 0 {
+			t.Fatalf("%s: expected a positive feature, got %f", plane.name, expected)
+		}
+		if v := plane.output.At(8, 8); math.Abs(float64(v-expected)) > 1e-6 {
+			t.Errorf("%s: expected the downsampled value %f, got %f", plane.name, expected, v)
+		}
+	}
+}
@@ -0,0 +1,212 @@
+/*
+ * Copyright (c) 2014-2017 Christian Muehlhaeuser
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+ *	Authors:
+ *		Christian Muehlhaeuser <muesli@gmail.com>
+ *		Michael Wendland <michael@michiwend.com>
+ *		Bjørn Erik Pedersen <bjorn.erik.pedersen@gmail.com>
+ */
+
+package smartcrop
+
+import (
+	"image"
+	"math"
+)
+
+// EdgeOperator selects how the detail feature gets detected
+type EdgeOperator int
+
+const (
+	// EdgeLaplacian is the magnitude of the 4-neighbour Laplacian
+	EdgeLaplacian EdgeOperator = iota
+	// EdgeSobel is the gradient magnitude of the Sobel operator
+	EdgeSobel
+	// EdgeScharr is the gradient magnitude of the Scharr operator, which is
+	// more rotation invariant than Sobel
+	EdgeScharr
+	// EdgeDoG is the magnitude of the difference of Gaussians, a band-pass
+	// that ignores pixel noise
+	EdgeDoG
+)
+
+const (
+	// dogSigma is the smaller of the two EdgeDoG blurs, the larger one is
+	// 1.6 times as wide
+	dogSigma = 1.0
+	// dogScale normalizes EdgeDoG, so a step edge responds like it does to
+	// the other operators
+	dogScale = 9.0
+)
+
+// edgeDetect returns the detail plane, computed from the lightness of the
+// image with the configured operator
+func edgeDetect(opts *Options, i *image.RGBA) *Plane {
+	width := i.Bounds().Dx()
+	height := i.Bounds().Dy()
+	cies := makeCies(opts, i)
+	if opts.EdgeBlur > 0 {
+		cies = gaussianBlur(cies, width, height, opts.EdgeBlur)
+	}
+	edges := edgeOperator(opts.EdgeOperator, cies, width, height)
+
+	// combine coarser levels of the pyramid, which see large structures
+	lw, lh := width, height
+	for scale := 1; scale < opts.EdgeScales; scale++ {
+		cies, lw, lh = halve(cies, lw, lh)
+		if lw < 3 || lh < 3 {
+			break
+		}
+
+		coarse := edgeOperator(opts.EdgeOperator, cies, lw, lh)
+		for y := 0; y < height; y++ {
+			cy := min(y>>uint(scale), lh-1)
+			for x := 0; x < width; x++ {
+				cx := min(x>>uint(scale), lw-1)
+				edges[y*width+x] = math.Max(edges[y*width+x], coarse[cy*lw+cx])
+			}
+		}
+	}
+
+	o := NewPlane(width, height)
+	for idx, e := range edges {
+		o.Pix[idx] = float32(e / 255.0)
+	}
+	return o
+}
+
+// edgeOperator applies the operator to the lightness
+func edgeOperator(op EdgeOperator, cies []float64, width, height int) []float64 {
+	switch op {
+	case EdgeSobel:
+		return gradient(cies, width, height, 1, 2, 4)
+	case EdgeScharr:
+		return gradient(cies, width, height, 3, 10, 16)
+	case EdgeDoG:
+		return differenceOfGaussians(cies, width, height)
+	}
+	return laplacian(cies, width, height)
+}
+
+// laplacian returns the magnitude of the Laplacian, the border keeps the
+// lightness itself
+func laplacian(cies []float64, width, height int) []float64 {
+	res := make([]float64, width*height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if x == 0 || x >= width-1 || y == 0 || y >= height-1 {
+				res[y*width+x] = cies[y*width+x]
+			} else {
+				res[y*width+x] = math.Abs(cies[y*width+x]*4.0 -
+					cies[x+(y-1)*width] -
+					cies[x-1+y*width] -
+					cies[x+1+y*width] -
+					cies[x+(y+1)*width])
+			}
+		}
+	}
+	return res
+}
+
+// gradient returns the gradient magnitude of a 3x3 operator with the given
+// corner and center weights, divided by norm. The border gets clamped.
+func gradient(cies []float64, width, height int, corner, center, norm float64) []float64 {
+	res := make([]float64, width*height)
+	at := func(x, y int) float64 {
+		return cies[clamp(y, 0, height-1)*width+clamp(x, 0, width-1)]
+	}
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			gx := corner*(at(x+1, y-1)-at(x-1, y-1)) +
+				center*(at(x+1, y)-at(x-1, y)) +
+				corner*(at(x+1, y+1)-at(x-1, y+1))
+			gy := corner*(at(x-1, y+1)-at(x-1, y-1)) +
+				center*(at(x, y+1)-at(x, y-1)) +
+				corner*(at(x+1, y+1)-at(x+1, y-1))
+			res[y*width+x] = math.Hypot(gx, gy) / norm
+		}
+	}
+	return res
+}
+
+// differenceOfGaussians returns the magnitude of the difference of two blurs
+func differenceOfGaussians(cies []float64, width, height int) []float64 {
+	fine := gaussianBlur(cies, width, height, dogSigma)
+	coarse := gaussianBlur(cies, width, height, dogSigma*1.6)
+	for idx := range fine {
+		fine[idx] = math.Abs(fine[idx]-coarse[idx]) * dogScale
+	}
+	return fine
+}
+
+// gaussianBlur returns a blurred copy, using a separable kernel and clamping
+// the border
+func gaussianBlur(cies []float64, width, height int, sigma float64) []float64 {
+	radius := int(math.Ceil(sigma * 3))
+	kernel := make([]float64, 2*radius+1)
+	var sum float64
+	for k := range kernel {
+		d := float64(k - radius)
+		kernel[k] = math.Exp(-d * d / (2 * sigma * sigma))
+		sum += kernel[k]
+	}
+	for k := range kernel {
+		kernel[k] /= sum
+	}
+
+	tmp := make([]float64, width*height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			var v float64
+			for k, w := range kernel {
+				v += cies[y*width+clamp(x+k-radius, 0, width-1)] * w
+			}
+			tmp[y*width+x] = v
+		}
+	}
+
+	res := make([]float64, width*height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			var v float64
+			for k, w := range kernel {
+				v += tmp[clamp(y+k-radius, 0, height-1)*width+x] * w
+			}
+			res[y*width+x] = v
+		}
+	}
+	return res
+}
+
+// halve returns the next level of the pyramid, averaging 2x2 blocks
+func halve(cies []float64, width, height int) ([]float64, int, int) {
+	w, h := width/2, height/2
+	res := make([]float64, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			res[y*w+x] = (cies[2*y*width+2*x] +
+				cies[2*y*width+2*x+1] +
+				cies[(2*y+1)*width+2*x] +
+				cies[(2*y+1)*width+2*x+1]) / 4
+		}
+	}
+	return res, w, h
+}
@@ -0,0 +1,137 @@
+/*
+ * Copyright (c) 2014-2017 Christian Muehlhaeuser
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+ *	Authors:
+ *		Christian Muehlhaeuser <muesli@gmail.com>
+ *		Michael Wendland <michael@michiwend.com>
+ *		Bjørn Erik Pedersen <bjorn.erik.pedersen@gmail.com>
+ */
+
+package smartcrop
+
+import (
+	"image"
+	"image/color"
+	"math/rand"
+	"testing"
+)
+
+var edgeOperators = []struct {
+	name string
+	op   EdgeOperator
+}{
+	{"laplacian", EdgeLaplacian},
+	{"sobel", EdgeSobel},
+	{"scharr", EdgeScharr},
+	{"dog", EdgeDoG},
+}
+
+func grayImage(width, height int, f func(x, y int) uint8) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			v := f(x, y)
+			img.SetRGBA(x, y, color.RGBA{v, v, v, 255})
+		}
+	}
+	return img
+}
+
+func meanPlane(p *Plane, r image.Rectangle) float64 {
+	var sum float64
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			sum += float64(p.At(x, y))
+		}
+	}
+	return sum / float64(r.Dx()*r.Dy())
+}
+
+func TestEdgeOperators(t *testing.T) {
+	img := grayImage(64, 64, func(x, y int) uint8 {
+		if x < 32 {
+			return 50
+		}
+		return 150
+	})
+	opts := DefaultOptions()
+	height := lightness(&opts, color.RGBA{150, 150, 150, 255}) - lightness(&opts, color.RGBA{50, 50, 50, 255})
+
+	for _, tt := range edgeOperators {
+		opts.EdgeOperator = tt.op
+		edges := edgeDetect(&opts, img)
+
+		var peak float64
+		for x := 1; x < 63; x++ {
+			if v := float64(edges.At(x, 32)); v > peak {
+				peak = v
+			}
+		}
+		if peak < 0.8*height || peak > 1.2*height {
+			t.Errorf("%s: expected a step edge response of about %.3f, got %.3f", tt.name, height, peak)
+		}
+		if v := edges.At(10, 32); v != 0 {
+			t.Errorf("%s: expected no response on a flat area, got %f", tt.name, v)
+		}
+	}
+}
+
+func TestEdgeBlur(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	img := grayImage(64, 64, func(x, y int) uint8 {
+		return uint8(118 + rnd.Intn(20))
+	})
+	inner := image.Rect(8, 8, 56, 56)
+
+	for _, tt := range edgeOperators {
+		opts := DefaultOptions()
+		opts.EdgeOperator = tt.op
+		noisy := meanPlane(edgeDetect(&opts, img), inner)
+		opts.EdgeBlur = 1.5
+		blurred := meanPlane(edgeDetect(&opts, img), inner)
+		if blurred >= noisy/2 {
+			t.Errorf("%s: expected blurring to suppress noise, got %f before and %f after", tt.name, noisy, blurred)
+		}
+	}
+}
+
+func TestEdgeScales(t *testing.T) {
+	// a soft ramp only shows up on the coarser levels
+	img := grayImage(64, 64, func(x, y int) uint8 {
+		return uint8(64 + 2*x)
+	})
+	inner := image.Rect(16, 16, 48, 48)
+
+	opts := DefaultOptions()
+	opts.EdgeOperator = EdgeSobel
+	single := meanPlane(edgeDetect(&opts, img), inner)
+	opts.EdgeScales = 3
+	multi := meanPlane(edgeDetect(&opts, img), inner)
+	if multi < 3*single {
+		t.Errorf("expected the pyramid to strengthen the ramp, got %f on one and %f on three scales", single, multi)
+	}
+
+	// too many levels stop at the smallest usable one
+	opts.EdgeScales = 20
+	if e := edgeDetect(&opts, img); e.Width != 64 || e.Height != 64 {
+		t.Errorf("expected a 64x64 plane, got %dx%d", e.Width, e.Height)
+	}
+}
@@ -0,0 +1,99 @@
+/*
+ * Copyright (c) 2014-2017 Christian Muehlhaeuser
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+ *	Authors:
+ *		Christian Muehlhaeuser <muesli@gmail.com>
+ *		Michael Wendland <michael@michiwend.com>
+ *		Bjørn Erik Pedersen <bjorn.erik.pedersen@gmail.com>
+ */
+
+package faces
+
+import (
+	"context"
+	"image"
+	"math"
+
+	"github.com/muesli/smartcrop"
+)
+
+// mergeThreshold is the overlap (intersection over union) above which a
+// Chain considers two regions the same face, e.g. found by two detectors.
+const mergeThreshold = 0.5
+
+// Chain is a FaceDetector running several detectors in order and merging
+// the faces they find.
+type Chain []FaceDetector
+
+// ChainError collects the errors of the detectors in a Chain.
+type ChainError = smartcrop.FaceErrors
+
+// DetectFaces implements FaceDetector. A failing detector doesn't stop the
+// others, the faces found by them get returned along with a ChainError. On
+// cancellation, the context's error gets returned instead.
+func (c Chain) DetectFaces(ctx context.Context, img image.Image, data []byte, format string) ([]smartcrop.BoostRegion, error) {
+	var boosts []smartcrop.BoostRegion
+	var errs ChainError
+	for _, d := range c {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		faces, err := d.DetectFaces(ctx, img, data, format)
+		if err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return nil, ctxErr
+			}
+			errs = append(errs, err)
+		}
+		boosts = mergeRegions(boosts, faces)
+	}
+
+	if len(errs) > 0 {
+		return boosts, errs
+	}
+	return boosts, nil
+}
+
+// mergeRegions adds the regions to boosts. Regions overlapping one already in
+// boosts get merged into it, keeping the union and the higher weight.
+func mergeRegions(boosts, regions []smartcrop.BoostRegion) []smartcrop.BoostRegion {
+	for _, r := range regions {
+		merged := false
+		for idx, b := range boosts {
+			if b.Mask != nil || r.Mask != nil || b.Weight < 0 || r.Weight < 0 ||
+				smartcrop.IntersectionOverUnion(b.Rect(), r.Rect()) <= mergeThreshold {
+				continue
+			}
+			u := b.Rect().Union(r.Rect())
+			b.X, b.Y, b.Width, b.Height = u.Min.X, u.Min.Y, u.Dx(), u.Dy()
+			b.Weight = math.Max(b.Weight, r.Weight)
+			b.Required = b.Required || r.Required
+			boosts[idx] = b
+			merged = true
+			break
+		}
+		if !merged {
+			boosts = append(boosts, r)
+		}
+	}
+	return boosts
+}
@@ -0,0 +1,148 @@
+/*
+ * Copyright (c) 2014-2017 Christian Muehlhaeuser
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+ *	Authors:
+ *		Christian Muehlhaeuser <muesli@gmail.com>
+ *		Michael Wendland <michael@michiwend.com>
+ *		Bjørn Erik Pedersen <bjorn.erik.pedersen@gmail.com>
+ */
+
+package faces
+
+import (
+	"context"
+	"errors"
+	"image"
+	"testing"
+
+	"github.com/muesli/smartcrop"
+	"github.com/muesli/smartcrop/nfnt"
+)
+
+// staticDetector returns the same faces for every image and records the
+// encoded data it got
+type staticDetector struct {
+	faces []smartcrop.BoostRegion
+	err   error
+	data  *[]byte
+}
+
+func (d staticDetector) DetectFaces(ctx context.Context, img image.Image, data []byte, format string) ([]smartcrop.BoostRegion, error) {
+	if d.data != nil {
+		*d.data = data
+	}
+	return d.faces, d.err
+}
+
+// cancellingDetector cancels the context while it runs and fails with its
+// error, like a detector interrupted by a timeout
+type cancellingDetector struct {
+	cancel context.CancelFunc
+}
+
+func (d cancellingDetector) DetectFaces(ctx context.Context, img image.Image, data []byte, format string) ([]smartcrop.BoostRegion, error) {
+	d.cancel()
+	return nil, ctx.Err()
+}
+
+func TestChain(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 200, 200))
+	errOffline := errors.New("service offline")
+	var data []byte
+	chain := Chain{
+		staticDetector{faces: []smartcrop.BoostRegion{{X: 10, Y: 10, Width: 40, Height: 40, Weight: 0.5}}},
+		staticDetector{err: errOffline, data: &data},
+		staticDetector{faces: []smartcrop.BoostRegion{
+			{X: 12, Y: 12, Width: 40, Height: 40, Weight: 1.0},
+			{X: 100, Y: 100, Width: 20, Height: 20, Weight: 1.0, Required: true},
+		}},
+	}
+
+	// the faces of the working detectors survive a failing one
+	faces, err := chain.DetectFaces(context.Background(), img, []byte("encoded"), "jpeg")
+	if errs, ok := err.(ChainError); !ok || len(errs) != 1 || errs[0] != errOffline || errs.Unwrap()[0] != errOffline {
+		t.Errorf("expected a ChainError with %v, got %v", errOffline, err)
+	}
+	if string(data) != "encoded" {
+		t.Errorf("expected the encoded data to get passed on, got %q", data)
+	}
+	if len(faces) != 2 {
+		t.Fatalf("expected 2 faces, got %v", faces)
+	}
+	if r := faces[0].Rect(); r != image.Rect(10, 10, 52, 52) || faces[0].Weight != 1.0 {
+		t.Errorf("expected the overlapping faces merged with the higher weight, got %+v", faces[0])
+	}
+	if !faces[1].Required {
+		t.Errorf("expected the second face to stay required, got %+v", faces[1])
+	}
+
+	faces, err = Chain{chain[0], chain[2]}.DetectFaces(context.Background(), img, nil, "")
+	if err != nil || len(faces) != 2 {
+		t.Errorf("expected 2 faces without an error, got %v and %v", faces, err)
+	}
+
+	// cancellation returns the context's error, before or during a detector
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if faces, err := chain.DetectFaces(ctx, img, nil, ""); err != context.Canceled || len(faces) != 0 {
+		t.Errorf("expected no faces and %v, got %v and %v", context.Canceled, faces, err)
+	}
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	if faces, err := (Chain{chain[0], cancellingDetector{cancel}, chain[2]}).DetectFaces(ctx, img, nil, ""); err != context.Canceled || len(faces) != 0 {
+		t.Errorf("expected no faces and %v, got %v and %v", context.Canceled, faces, err)
+	}
+}
+
+func TestChainAnalyzer(t *testing.T) {
+	img := loadImage(t, "../examples/gopher.jpg")
+	errOffline := errors.New("service offline")
+	face := smartcrop.BoostRegion{X: 500, Y: 10, Width: 40, Height: 40, Weight: 1.0, Required: true}
+
+	// the analyzer keeps the faces of a chain with a failing detector
+	opts := smartcrop.DefaultOptions()
+	opts.Prescale = false
+	opts.FaceDetector = Chain{staticDetector{faces: []smartcrop.BoostRegion{face}}, staticDetector{err: errOffline}}
+	analyzer := smartcrop.NewAnalyzerWithOptions(nfnt.NewDefaultResizer(), smartcrop.Logger{}, opts)
+	topCrop, err := analyzer.FindBestCrop(img, 100, 100, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !face.Rect().In(topCrop) {
+		t.Errorf("expected crop %v to contain the face %v", topCrop, face.Rect())
+	}
+
+	// but fails on other errors and returns the context's error on
+	// cancellation
+	opts.FaceDetector = staticDetector{err: errOffline}
+	analyzer = smartcrop.NewAnalyzerWithOptions(nfnt.NewDefaultResizer(), smartcrop.Logger{}, opts)
+	if _, err := analyzer.FindBestCrop(img, 100, 100, nil); err != errOffline {
+		t.Errorf("expected %v, got %v", errOffline, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	opts.FaceDetector = Chain{staticDetector{faces: []smartcrop.BoostRegion{face}}, cancellingDetector{cancel}}
+	analyzer = smartcrop.NewAnalyzerWithOptions(nfnt.NewDefaultResizer(), smartcrop.Logger{}, opts)
+	if _, err := analyzer.FindBestCropContext(ctx, img, 100, 100, nil); err != context.Canceled {
+		t.Errorf("expected %v, got %v", context.Canceled, err)
+	}
+}
@@ -0,0 +1,86 @@
+/*
+ * Copyright (c) 2014-2017 Christian Muehlhaeuser
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+ *	Authors:
+ *		Christian Muehlhaeuser <muesli@gmail.com>
+ *		Michael Wendland <michael@michiwend.com>
+ *		Bjørn Erik Pedersen <bjorn.erik.pedersen@gmail.com>
+ */
+
+package faces
+
+import (
+	"image"
+	"math"
+	"sort"
+
+	pigo "github.com/esimov/pigo/core"
+	"github.com/muesli/smartcrop"
+)
+
+// detection is a face found by the cascade rotated by angle
+type detection struct {
+	pigo.Detection
+	angle float64
+}
+
+// rect returns the axis-aligned bounds of the rotated detection window
+func (d detection) rect() image.Rectangle {
+	size := float64(d.Scale) * (math.Abs(math.Cos(d.angle)) + math.Abs(math.Sin(d.angle)))
+	half := int(math.Round(size / 2))
+	return image.Rect(d.Col-half, d.Row-half, d.Col+half, d.Row+half)
+}
+
+// clusterAngles merges detections of the same face found at different
+// angles. A cluster takes the angle and quality of its best detection and
+// the quality weighted mean of the positions and sizes.
+func clusterAngles(dets []detection, threshold float64) []detection {
+	sort.SliceStable(dets, func(i, j int) bool {
+		return dets[i].Q > dets[j].Q
+	})
+
+	var res []detection
+	assigned := make([]bool, len(dets))
+	for i, best := range dets {
+		if assigned[i] {
+			continue
+		}
+
+		var row, col, scale, q float64
+		for j := i; j < len(dets); j++ {
+			if j != i && (assigned[j] || smartcrop.IntersectionOverUnion(best.rect(), dets[j].rect()) <= threshold) {
+				continue
+			}
+			assigned[j] = true
+			w := float64(dets[j].Q)
+			row += float64(dets[j].Row) * w
+			col += float64(dets[j].Col) * w
+			scale += float64(dets[j].Scale) * w
+			q += w
+		}
+
+		best.Row = int(math.Round(row / q))
+		best.Col = int(math.Round(col / q))
+		best.Scale = int(math.Round(scale / q))
+		res = append(res, best)
+	}
+	return res
+}
@@ -0,0 +1,128 @@
+/*
+ * Copyright (c) 2014-2017 Christian Muehlhaeuser
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+ *	Authors:
+ *		Christian Muehlhaeuser <muesli@gmail.com>
+ *		Michael Wendland <michael@michiwend.com>
+ *		Bjørn Erik Pedersen <bjorn.erik.pedersen@gmail.com>
+ */
+
+package faces
+
+import (
+	"image"
+	"io/ioutil"
+	"math"
+
+	pigo "github.com/esimov/pigo/core"
+)
+
+// Position of the eyes relative to the center of an upright face, and the
+// size of the puploc search window, all relative to the face size. These
+// match the values used by pigo.
+const (
+	eyeOffsetX = 0.175
+	eyeOffsetY = -0.075
+	eyeScale   = 0.25
+	eyeLinePad = 0.15
+)
+
+// LoadPuploc enables the eye detection using the given pigo puploc cascade.
+func (d *PigoDetector) LoadPuploc(cascade []byte) error {
+	puploc, err := unpackPuploc(cascade)
+	if err != nil {
+		return err
+	}
+	d.puploc = puploc
+	return nil
+}
+
+// LoadPuplocFile enables the eye detection using the puploc cascade file.
+func (d *PigoDetector) LoadPuplocFile(file string) error {
+	cascade, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	return d.LoadPuploc(cascade)
+}
+
+// unpackPuploc unpacks the puploc cascade, pigo panics on truncated data
+func unpackPuploc(cascade []byte) (puploc *pigo.PuplocCascade, err error) {
+	defer func() {
+		if recover() != nil {
+			puploc, err = nil, ErrInvalidCascade
+		}
+	}()
+
+	puploc, err = pigo.NewPuplocCascade().UnpackCascade(cascade)
+	if err != nil || len(cascade) == 0 {
+		return nil, ErrInvalidCascade
+	}
+	return puploc, nil
+}
+
+// eyeSeed returns the expected position of the left (side -1) or right
+// (side 1) eye of the face, following its rotation
+func eyeSeed(det detection, side float64) image.Point {
+	s := float64(det.Scale)
+	dx := side * eyeOffsetX * s
+	dy := eyeOffsetY * s
+
+	// pigo rotates its sampling points by the angle
+	sin, cos := math.Sincos(det.angle)
+	return image.Pt(
+		det.Col+int(math.Round(sin*dy+cos*dx)),
+		det.Row+int(math.Round(cos*dy-sin*dx)),
+	)
+}
+
+// locateEyes returns the rectangle around the eye line of the face. It
+// fails if neither eye is found within the face.
+func (d *PigoDetector) locateEyes(det detection, params pigo.ImageParams) (image.Rectangle, bool) {
+	perturbs := d.EyePerturbs
+	if perturbs < 1 {
+		perturbs = 1
+	}
+
+	face := det.rect()
+	var line image.Rectangle
+	for _, side := range []float64{-1, 1} {
+		seed := eyeSeed(det, side)
+		eye := d.puploc.RunDetector(pigo.Puploc{
+			Row:      seed.Y,
+			Col:      seed.X,
+			Scale:    float32(det.Scale) * eyeScale,
+			Perturbs: perturbs,
+		}, params, turns(det.angle), false)
+
+		p := image.Pt(eye.Col, eye.Row)
+		if eye.Row <= 0 || eye.Col <= 0 || !p.In(face) {
+			continue
+		}
+		line = line.Union(image.Rectangle{p, p.Add(image.Pt(1, 1))})
+	}
+	if line.Empty() {
+		return image.Rectangle{}, false
+	}
+
+	pad := int(math.Round(eyeLinePad * float64(det.Scale)))
+	return line.Inset(-pad).Intersect(face), true
+}
@@ -0,0 +1,253 @@
+/*
+ * Copyright (c) 2014-2017 Christian Muehlhaeuser
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+ *	Authors:
+ *		Christian Muehlhaeuser <muesli@gmail.com>
+ *		Michael Wendland <michael@michiwend.com>
+ *		Bjørn Erik Pedersen <bjorn.erik.pedersen@gmail.com>
+ */
+
+// Package faces finds faces in images, so they can be kept in the crop. The
+// detections get returned as smartcrop boost regions.
+package faces
+
+import (
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"io/ioutil"
+	"math"
+
+	pigo "github.com/esimov/pigo/core"
+	"github.com/muesli/smartcrop"
+)
+
+// ErrInvalidCascade gets returned when a cascade can't be unpacked
+var ErrInvalidCascade = errors.New("Invalid face detection cascade")
+
+// FaceDetector finds faces and returns them as boost regions in the image's
+// coordinates. Set one as smartcrop.Options.FaceDetector to run it on every
+// analyzed image.
+type FaceDetector = smartcrop.FaceDetector
+
+// PigoDetector is a pure Go FaceDetector using a pigo cascade, e.g. the
+// facefinder cascade shipped with pigo. The parameters default to values
+// working well for photos.
+type PigoDetector struct {
+	// MinSize and MaxSize limit the size of faces in pixels.
+	MinSize int
+	MaxSize int
+	// ShiftFactor is the step of the detection window relative to its size.
+	ShiftFactor float64
+	// ScaleFactor is the factor between two detection window sizes.
+	ScaleFactor float64
+	// IoUThreshold is the overlap above which detections get merged.
+	IoUThreshold float64
+	// QualityThreshold is the minimum detection score of a face.
+	QualityThreshold float32
+	// Angles are the rotations in radians the cascade runs at, which finds
+	// tilted heads and faces in sideways photos. Detections of the same face
+	// at different angles get merged.
+	Angles []float64
+	// Weight and Shape are used for the boost regions of the faces.
+	Weight float64
+	Shape  smartcrop.BoostShape
+	// EyeWeight is the weight of the boost region around the eye line,
+	// which gets added once a puploc cascade is loaded and the eyes of a
+	// face are found. The face region's weight then gets multiplied by
+	// EyeFaceRatio, so the eyes stand out.
+	EyeWeight    float64
+	EyeFaceRatio float64
+	// EyePerturbs is the number of randomly perturbed runs of the puploc
+	// cascade per eye, the median of which is the eye position.
+	EyePerturbs int
+
+	classifier *pigo.Pigo
+	puploc     *pigo.PuplocCascade
+}
+
+// NewPigoDetector returns a PigoDetector using the given cascade.
+func NewPigoDetector(cascade []byte) (*PigoDetector, error) {
+	classifier, err := unpack(cascade)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PigoDetector{
+		MinSize:          20,
+		MaxSize:          1000,
+		ShiftFactor:      0.1,
+		ScaleFactor:      1.1,
+		IoUThreshold:     0.2,
+		QualityThreshold: 10.0,
+		Angles:           []float64{0},
+		Weight:           1.0,
+		Shape:            smartcrop.ShapeEllipse,
+		EyeWeight:        1.0,
+		EyeFaceRatio:     0.5,
+		EyePerturbs:      63,
+		classifier:       classifier,
+	}, nil
+}
+
+// NewPigoDetectorFromFile returns a PigoDetector using the cascade file.
+func NewPigoDetectorFromFile(file string) (*PigoDetector, error) {
+	cascade, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return NewPigoDetector(cascade)
+}
+
+// unpack unpacks the cascade, pigo panics on truncated data
+func unpack(cascade []byte) (classifier *pigo.Pigo, err error) {
+	defer func() {
+		if recover() != nil {
+			classifier, err = nil, ErrInvalidCascade
+		}
+	}()
+
+	classifier, err = pigo.NewPigo().Unpack(cascade)
+	if err != nil {
+		return nil, ErrInvalidCascade
+	}
+	return classifier, nil
+}
+
+// DetectFaces implements FaceDetector. The context gets checked between the
+// cascade runs, the encoded data isn't needed.
+func (d *PigoDetector) DetectFaces(ctx context.Context, img image.Image, data []byte, format string) ([]smartcrop.BoostRegion, error) {
+	bounds := img.Bounds()
+	pixels := grayscale(img)
+
+	params := map[float64]pigo.ImageParams{}
+	var dets []detection
+	for _, angle := range d.Angles {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		params[angle] = imageParams(pixels, bounds.Dx(), bounds.Dy(), angle)
+		for _, det := range d.runCascade(params[angle], angle) {
+			if det.Q > d.QualityThreshold {
+				dets = append(dets, detection{Detection: det, angle: angle})
+			}
+		}
+	}
+	dets = clusterAngles(dets, d.IoUThreshold)
+
+	var boosts []smartcrop.BoostRegion
+	for _, det := range dets {
+		var eyes image.Rectangle
+		weight := d.Weight
+		if d.puploc != nil {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			var ok bool
+			if eyes, ok = d.locateEyes(det, params[det.angle]); ok {
+				weight *= d.EyeFaceRatio
+			}
+		}
+		// later regions overwrite the ones they cover, so the eye line goes
+		// last to stand out from the face
+		boosts = appendRegion(boosts, det.rect(), bounds, weight, d.Shape)
+		if !eyes.Empty() {
+			boosts = appendRegion(boosts, eyes, bounds, d.EyeWeight, d.Shape)
+		}
+	}
+	return boosts, nil
+}
+
+// appendRegion appends the rectangle, which is relative to the image's
+// origin, as a boost region clipped to the image
+func appendRegion(boosts []smartcrop.BoostRegion, r, bounds image.Rectangle, weight float64, shape smartcrop.BoostShape) []smartcrop.BoostRegion {
+	r = r.Add(bounds.Min).Intersect(bounds)
+	if r.Empty() {
+		return boosts
+	}
+	return append(boosts, smartcrop.BoostRegion{
+		X:      r.Min.X,
+		Y:      r.Min.Y,
+		Width:  r.Dx(),
+		Height: r.Dy(),
+		Weight: weight,
+		Shape:  shape,
+	})
+}
+
+// turns converts radians to the turns within 0..1 pigo expects
+func turns(angle float64) float64 {
+	t := math.Mod(angle/(2*math.Pi), 1)
+	if t < 0 {
+		t++
+	}
+	return t
+}
+
+// imageParams returns the grayscale image prepared for running cascades at
+// the angle
+func imageParams(pixels []uint8, cols, rows int, angle float64) pigo.ImageParams {
+	// pigo clamps the columns of rotated windows to the number of rows, so
+	// landscape images get padded to a square
+	dim := cols
+	if turns(angle) > 0 && cols > rows {
+		padded := make([]uint8, cols*cols)
+		copy(padded, pixels)
+		pixels, rows = padded, cols
+	}
+
+	return pigo.ImageParams{
+		Pixels: pixels,
+		Rows:   rows,
+		Cols:   cols,
+		Dim:    dim,
+	}
+}
+
+// runCascade returns the clustered detections at the angle
+func (d *PigoDetector) runCascade(params pigo.ImageParams, angle float64) []pigo.Detection {
+	cascadeParams := pigo.CascadeParams{
+		MinSize:     d.MinSize,
+		MaxSize:     d.MaxSize,
+		ShiftFactor: d.ShiftFactor,
+		ScaleFactor: d.ScaleFactor,
+		ImageParams: params,
+	}
+
+	dets := d.classifier.RunCascade(cascadeParams, turns(angle))
+	return d.classifier.ClusterDetections(dets, d.IoUThreshold)
+}
+
+// grayscale returns the luma of the image row by row, starting at its
+// origin
+func grayscale(img image.Image) []uint8 {
+	bounds := img.Bounds()
+	res := make([]uint8, bounds.Dx()*bounds.Dy())
+	i := 0
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			res[i] = color.GrayModel.Convert(img.At(x, y)).(color.Gray).Y
+			i++
+		}
+	}
+	return res
+}
@@ -0,0 +1,292 @@
+/*
+ * Copyright (c) 2014-2017 Christian Muehlhaeuser
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+ *	Authors:
+ *		Christian Muehlhaeuser <muesli@gmail.com>
+ *		Michael Wendland <michael@michiwend.com>
+ *		Bjørn Erik Pedersen <bjorn.erik.pedersen@gmail.com>
+ */
+
+package faces
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/jpeg"
+	"math"
+	"os"
+	"testing"
+
+	pigo "github.com/esimov/pigo/core"
+	"github.com/muesli/smartcrop"
+	"github.com/muesli/smartcrop/nfnt"
+)
+
+const (
+	cascadeFile = "../cascade/facefinder"
+	puplocFile  = "../cascade/puploc"
+)
+
+func loadImage(t testing.TB, path string) image.Image {
+	t.Helper()
+	fi, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fi.Close()
+
+	img, _, err := image.Decode(fi)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return img
+}
+
+func TestPigoDetector(t *testing.T) {
+	d, err := NewPigoDetectorFromFile(cascadeFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.MinSize != 20 || d.MaxSize != 1000 || d.QualityThreshold != 10 || d.Shape != smartcrop.ShapeEllipse {
+		t.Errorf("unexpected defaults %+v", d)
+	}
+
+	img := loadImage(t, "../examples/gopher.jpg")
+
+	// the gopher has no human face
+	faces, err := d.DetectFaces(context.Background(), img, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(faces) != 0 {
+		t.Errorf("expected no faces, got %v", faces)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := d.DetectFaces(ctx, img, nil, ""); err != context.Canceled {
+		t.Errorf("expected %v, got %v", context.Canceled, err)
+	}
+
+	opts := smartcrop.DefaultOptions()
+	opts.FaceDetector = d
+	analyzer := smartcrop.NewAnalyzerWithOptions(nfnt.NewDefaultResizer(), smartcrop.Logger{}, opts)
+	if _, err := analyzer.FindBestCrop(img, 250, 250, nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestInvalidCascade(t *testing.T) {
+	for _, cascade := range [][]byte{nil, []byte("not a cascade")} {
+		if _, err := NewPigoDetector(cascade); err != ErrInvalidCascade {
+			t.Errorf("expected %v, got %v", ErrInvalidCascade, err)
+		}
+	}
+	if _, err := NewPigoDetectorFromFile("./does-not-exist"); err == nil {
+		t.Errorf("expected an error for a missing cascade file")
+	}
+}
+
+func TestGrayscale(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	img.Set(2, 3, color.White)
+	sub := img.SubImage(image.Rect(1, 2, 4, 4))
+
+	gray := grayscale(sub)
+	if len(gray) != 6 {
+		t.Fatalf("expected 6 pixels, got %d", len(gray))
+	}
+	expected := []uint8{0, 0, 0, 0, 255, 0}
+	for i, v := range gray {
+		if v != expected[i] {
+			t.Errorf("pixel %d: expected %d, got %d", i, expected[i], v)
+		}
+	}
+}
+
+// rotateClockwise returns the image turned by a quarter turn clockwise
+func rotateClockwise(img image.Image) *image.Gray {
+	b := img.Bounds()
+	res := image.NewGray(image.Rect(0, 0, b.Dy(), b.Dx()))
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			res.Set(b.Max.Y-1-y, x-b.Min.X, img.At(x, y))
+		}
+	}
+	return res
+}
+
+func TestAngles(t *testing.T) {
+	d, err := NewPigoDetectorFromFile(cascadeFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a face cropped from a NASA group photo, which is in the public domain
+	img := loadImage(t, "testdata/face.jpg")
+
+	faces, err := d.DetectFaces(context.Background(), img, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(faces) != 1 {
+		t.Fatalf("expected the upright face, got %v", faces)
+	}
+	face := faces[0]
+	center := image.Pt(face.X+face.Width/2, face.Y+face.Height/2)
+
+	// the face turned clockwise, on a landscape image with an offset origin
+	bounds := image.Rect(50, 20, 450, 20+img.Bounds().Dx())
+	offset := image.Pt(bounds.Min.X+250, bounds.Min.Y)
+	sideways := image.NewGray(bounds)
+	draw.Draw(sideways, bounds, image.NewUniform(color.Gray{Y: 40}), image.ZP, draw.Src)
+	rotated := rotateClockwise(img)
+	draw.Draw(sideways, rotated.Bounds().Add(offset), rotated, image.ZP, draw.Src)
+	expected := image.Pt(img.Bounds().Dy()-1-center.Y, center.X).Add(offset)
+
+	faces, err = d.DetectFaces(context.Background(), sideways, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(faces) != 0 {
+		t.Errorf("expected no upright faces, got %v", faces)
+	}
+
+	// negative angles find faces turned clockwise
+	d.Angles = []float64{0, -math.Pi / 2}
+	faces, err = d.DetectFaces(context.Background(), sideways, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(faces) != 1 {
+		t.Fatalf("expected the sideways face, got %v", faces)
+	}
+	r := image.Rect(faces[0].X, faces[0].Y, faces[0].X+faces[0].Width, faces[0].Y+faces[0].Height)
+	if !r.In(bounds) {
+		t.Errorf("expected face %v inside the image %v", r, bounds)
+	}
+	if c := image.Pt(r.Min.X+r.Dx()/2, r.Min.Y+r.Dy()/2); math.Abs(float64(c.X-expected.X)) > 3 || math.Abs(float64(c.Y-expected.Y)) > 3 {
+		t.Errorf("expected the face around %v, got %v", expected, r)
+	}
+	if r.Dx() != face.Width || r.Dy() != face.Height {
+		t.Errorf("expected a face of %dx%d, got %v", face.Width, face.Height, r)
+	}
+}
+
+func TestClusterAngles(t *testing.T) {
+	dets := []detection{
+		{Detection: pigo.Detection{Row: 100, Col: 100, Scale: 40, Q: 10}, angle: 0},
+		{Detection: pigo.Detection{Row: 104, Col: 100, Scale: 40, Q: 30}, angle: math.Pi / 12},
+		{Detection: pigo.Detection{Row: 300, Col: 300, Scale: 40, Q: 5}, angle: math.Pi / 2},
+	}
+
+	clusters := clusterAngles(dets, 0.2)
+	if len(clusters) != 2 {
+		t.Fatalf("expected 2 faces, got %v", clusters)
+	}
+	if c := clusters[0]; c.angle != math.Pi/12 || c.Q != 30 || c.Row != 103 || c.Col != 100 {
+		t.Errorf("expected the strongest angle and weighted position, got %+v", c)
+	}
+	if r := clusters[1].rect(); r != image.Rect(280, 280, 320, 320) {
+		t.Errorf("expected a quarter turn to keep the window size, got %v", r)
+	}
+
+	diagonal := detection{Detection: pigo.Detection{Row: 0, Col: 0, Scale: 100}, angle: math.Pi / 4}
+	if r := diagonal.rect(); r.Dx() != 142 {
+		t.Errorf("expected the bounds of a diagonal window to grow to 142, got %d", r.Dx())
+	}
+}
+
+func TestEyeSeed(t *testing.T) {
+	det := detection{Detection: pigo.Detection{Row: 200, Col: 100, Scale: 80}}
+	if left, right := eyeSeed(det, -1), eyeSeed(det, 1); left != image.Pt(86, 194) || right != image.Pt(114, 194) {
+		t.Errorf("expected the eyes of an upright face at (86,194) and (114,194), got %v and %v", left, right)
+	}
+
+	// a quarter turn moves the eye line to a column
+	det.angle = math.Pi / 2
+	if left, right := eyeSeed(det, -1), eyeSeed(det, 1); left != image.Pt(94, 214) || right != image.Pt(94, 186) {
+		t.Errorf("expected the eyes of a rotated face at (94,214) and (94,186), got %v and %v", left, right)
+	}
+}
+
+func TestEyes(t *testing.T) {
+	d, err := NewPigoDetectorFromFile(cascadeFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.LoadPuplocFile(puplocFile); err != nil {
+		t.Fatal(err)
+	}
+	img := loadImage(t, "testdata/face.jpg")
+
+	faces, err := d.DetectFaces(context.Background(), img, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(faces) != 2 {
+		t.Fatalf("expected the face and its eye line, got %v", faces)
+	}
+	face, eyes := faces[0], faces[1]
+	faceRect := image.Rect(face.X, face.Y, face.X+face.Width, face.Y+face.Height)
+	eyeRect := image.Rect(eyes.X, eyes.Y, eyes.X+eyes.Width, eyes.Y+eyes.Height)
+	if face.Weight != d.Weight*d.EyeFaceRatio || eyes.Weight != d.EyeWeight {
+		t.Errorf("expected weights %f and %f, got %f and %f", d.Weight*d.EyeFaceRatio, d.EyeWeight, face.Weight, eyes.Weight)
+	}
+	if !eyeRect.In(faceRect) || eyeRect.Max.Y > faceRect.Min.Y+faceRect.Dy()*2/3 || eyeRect.Dx() < faceRect.Dx()/4 {
+		t.Errorf("expected the eye line %v in the upper part of the face %v", eyeRect, faceRect)
+	}
+
+	// the eye line stands out from the rest of the face in the boost plane
+	opts := smartcrop.DefaultOptions()
+	opts.Prescale = false
+	opts.FaceDetector = d
+	analyzer := smartcrop.NewAnalyzerWithOptions(nfnt.NewDefaultResizer(), smartcrop.Logger{}, opts)
+	fm, err := analyzer.NewFeatureMap(img, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	center := image.Pt(faceRect.Min.X+faceRect.Dx()/2, faceRect.Min.Y+faceRect.Dy()/2)
+	eyeLine := fm.Boost.At(center.X, eyeRect.Min.Y+eyeRect.Dy()/2)
+	mouth := fm.Boost.At(center.X, faceRect.Min.Y+faceRect.Dy()*3/4)
+	if eyeLine <= mouth || mouth <= 0 {
+		t.Errorf("expected the eye line to score above the rest of the face, got %f and %f", eyeLine, mouth)
+	}
+}
+
+func TestInvalidPuploc(t *testing.T) {
+	d, err := NewPigoDetectorFromFile(cascadeFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, cascade := range [][]byte{nil, []byte("not a cascade")} {
+		if err := d.LoadPuploc(cascade); err != ErrInvalidCascade {
+			t.Errorf("expected %v, got %v", ErrInvalidCascade, err)
+		}
+	}
+	if err := d.LoadPuplocFile("./does-not-exist"); err == nil {
+		t.Errorf("expected an error for a missing cascade file")
+	}
+	if d.puploc != nil {
+		t.Errorf("expected the eye detection to stay disabled")
+	}
+}
@@ -0,0 +1,266 @@
+/*
+ * Copyright (c) 2014-2017 Christian Muehlhaeuser
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+ *	Authors:
+ *		Christian Muehlhaeuser <muesli@gmail.com>
+ *		Michael Wendland <michael@michiwend.com>
+ *		Bjørn Erik Pedersen <bjorn.erik.pedersen@gmail.com>
+ */
+
+package smartcrop
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"time"
+)
+
+// featureMapMagic prefixes encoded feature maps, the last byte is the version
+var featureMapMagic = []byte("SCFM\x05")
+
+// FeatureMap is the result of analysing an image. It can be stored and used to
+// find crops for other sizes later on, without decoding and analysing the
+// original image again.
+type FeatureMap struct {
+	// Detail, Skin, Saturation and Boost are the feature planes of the
+	// prescaled image, all of the same size
+	Detail     *Plane
+	Skin       *Plane
+	Saturation *Plane
+	Boost      *Plane
+	// Penalty holds the penalty regions (boosts with negative weights), or
+	// nil if there are none
+	Penalty *Plane
+	// Extra is the weighted sum of the planes of Options.Detectors, or nil if
+	// there are no additional detectors
+	Extra *Plane
+	// Prescale is the factor the original image got scaled by
+	Prescale float64
+	// Bounds are the bounds of the original image
+	Bounds image.Rectangle
+	// Required is the union of all required boost regions in original image
+	// coordinates, every crop has to contain it
+	Required image.Rectangle
+}
+
+type featureMapHeader struct {
+	MinX, MinY, MaxX, MaxY int32
+	RequiredMinX           int32
+	RequiredMinY           int32
+	RequiredMaxX           int32
+	RequiredMaxY           int32
+	Width, Height          int32
+	Prescale               float64
+	HasPenalty             bool
+	HasExtra               bool
+}
+
+// planes returns the feature planes in their encoding order, skipping the
+// optional ones that aren't set
+func (fm *FeatureMap) planes() []*Plane {
+	planes := []*Plane{fm.Detail, fm.Skin, fm.Saturation, fm.Boost}
+	if fm.Penalty != nil {
+		planes = append(planes, fm.Penalty)
+	}
+	if fm.Extra != nil {
+		planes = append(planes, fm.Extra)
+	}
+	return planes
+}
+
+func (fm *FeatureMap) validate() error {
+	if fm == nil || fm.Detail == nil || fm.Prescale <= 0 || fm.Bounds.Empty() {
+		return ErrInvalidFeatureMap
+	}
+	if fm.Detail.Bounds().Empty() {
+		return ErrInvalidFeatureMap
+	}
+	for _, p := range fm.planes() {
+		if p == nil || p.Width != fm.Detail.Width || p.Height != fm.Detail.Height || len(p.Pix) != p.Width*p.Height {
+			return ErrInvalidFeatureMap
+		}
+	}
+	return nil
+}
+
+// Image converts the feature map into an image showing skin (R), detail (G),
+// saturation (B) and boost (A), for debugging.
+func (fm *FeatureMap) Image() *image.RGBA {
+	o := image.NewRGBA(fm.Detail.Bounds())
+	for y := 0; y < fm.Detail.Height; y++ {
+		for x := 0; x < fm.Detail.Width; x++ {
+			o.SetRGBA(x, y, color.RGBA{
+				R: uint8(bounds(float64(fm.Skin.At(x, y)) * 255)),
+				G: uint8(bounds(float64(fm.Detail.At(x, y)) * 255)),
+				B: uint8(bounds(float64(fm.Saturation.At(x, y)) * 255)),
+				A: uint8(bounds(float64(fm.Boost.At(x, y)) * 255)),
+			})
+		}
+	}
+	return o
+}
+
+// MarshalBinary encodes the feature map into a compact binary form.
+func (fm *FeatureMap) MarshalBinary() ([]byte, error) {
+	if err := fm.validate(); err != nil {
+		return nil, err
+	}
+
+	header := featureMapHeader{
+		MinX:         int32(fm.Bounds.Min.X),
+		MinY:         int32(fm.Bounds.Min.Y),
+		MaxX:         int32(fm.Bounds.Max.X),
+		MaxY:         int32(fm.Bounds.Max.Y),
+		RequiredMinX: int32(fm.Required.Min.X),
+		RequiredMinY: int32(fm.Required.Min.Y),
+		RequiredMaxX: int32(fm.Required.Max.X),
+		RequiredMaxY: int32(fm.Required.Max.Y),
+		Width:        int32(fm.Detail.Width),
+		Height:       int32(fm.Detail.Height),
+		Prescale:     fm.Prescale,
+		HasPenalty:   fm.Penalty != nil,
+		HasExtra:     fm.Extra != nil,
+	}
+
+	var buf bytes.Buffer
+	buf.Write(featureMapMagic)
+	if err := binary.Write(&buf, binary.LittleEndian, header); err != nil {
+		return nil, err
+	}
+	for _, p := range fm.planes() {
+		if err := binary.Write(&buf, binary.LittleEndian, p.Pix); err != nil {
+			return nil, err
+		}
+	}
+
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary decodes a feature map encoded by MarshalBinary.
+func (fm *FeatureMap) UnmarshalBinary(data []byte) error {
+	if !bytes.HasPrefix(data, featureMapMagic) {
+		return ErrInvalidFeatureMap
+	}
+
+	r := bytes.NewReader(data[len(featureMapMagic):])
+	var header featureMapHeader
+	if err := binary.Read(r, binary.LittleEndian, &header); err != nil {
+		return ErrInvalidFeatureMap
+	}
+	width, height := int(header.Width), int(header.Height)
+
+	// check the size before allocating anything, the data may be corrupt
+	count := 4
+	if header.HasPenalty {
+		count++
+	}
+	if header.HasExtra {
+		count++
+	}
+	if width <= 0 || height <= 0 || int64(r.Len()) != int64(width)*int64(height)*4*int64(count) {
+		return ErrInvalidFeatureMap
+	}
+
+	decoded := FeatureMap{
+		Detail:     NewPlane(width, height),
+		Skin:       NewPlane(width, height),
+		Saturation: NewPlane(width, height),
+		Boost:      NewPlane(width, height),
+		Prescale:   header.Prescale,
+		Bounds:     image.Rect(int(header.MinX), int(header.MinY), int(header.MaxX), int(header.MaxY)),
+		Required:   image.Rect(int(header.RequiredMinX), int(header.RequiredMinY), int(header.RequiredMaxX), int(header.RequiredMaxY)),
+	}
+	if header.HasPenalty {
+		decoded.Penalty = NewPlane(width, height)
+	}
+	if header.HasExtra {
+		decoded.Extra = NewPlane(width, height)
+	}
+
+	for _, p := range decoded.planes() {
+		if err := binary.Read(r, binary.LittleEndian, p.Pix); err != nil {
+			return ErrInvalidFeatureMap
+		}
+	}
+
+	*fm = decoded
+	return fm.validate()
+}
+
+// analyse runs the feature detection on the prescaled image, checking the
+// context between the single passes
+func analyse(ctx context.Context, logger Logger, opts *Options, img *image.RGBA, boosts []BoostRegion) (*FeatureMap, error) {
+	fm := &FeatureMap{Prescale: 1.0}
+
+	for _, builtin := range []struct {
+		detector Detector
+		plane    **Plane
+	}{
+		{edgeDetector{opts}, &fm.Detail},
+		{skinDetector{opts}, &fm.Skin},
+		{saturationDetector{opts}, &fm.Saturation},
+	} {
+		now := time.Now()
+		p, err := detect(builtin.detector, img)
+		if err != nil {
+			return nil, err
+		}
+		*builtin.plane = p
+		logger.Log.Println("Time elapsed "+builtin.detector.Name()+":", time.Since(now))
+		debugPlane(logger.DebugMode, p, builtin.detector.Name())
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, d := range opts.Detectors {
+		now := time.Now()
+		p, err := detect(d, img)
+		if err != nil {
+			return nil, err
+		}
+		if fm.Extra == nil {
+			fm.Extra = NewPlane(p.Width, p.Height)
+		}
+		addPlane(fm.Extra, p, d.Weight())
+		logger.Log.Println("Time elapsed "+d.Name()+":", time.Since(now))
+		debugPlane(logger.DebugMode, p, d.Name())
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	now := time.Now()
+	fm.Boost, fm.Penalty = applyBoosts(boosts, img.Bounds().Dx(), img.Bounds().Dy())
+	logger.Log.Println("Time elapsed boost:", time.Since(now))
+	debugPlane(logger.DebugMode, fm.Boost, "boost")
+	if fm.Penalty != nil {
+		debugPlane(logger.DebugMode, fm.Penalty, "penalty")
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return fm, nil
+}
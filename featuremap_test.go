@@ -0,0 +1,127 @@
+/*
+ * Copyright (c) 2014-2017 Christian Muehlhaeuser
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+ *	Authors:
+ *		Christian Muehlhaeuser <muesli@gmail.com>
+ *		Michael Wendland <michael@michiwend.com>
+ *		Bjørn Erik Pedersen <bjorn.erik.pedersen@gmail.com>
+ */
+
+package smartcrop
+
+import (
+	"encoding/binary"
+	"image"
+	"reflect"
+	"testing"
+
+	"github.com/muesli/smartcrop/nfnt"
+)
+
+func TestFeatureMap(t *testing.T) {
+	img := loadTestImage(t, testFile)
+
+	analyzer := NewAnalyzerWithOptions(nfnt.NewDefaultResizer(), Logger{}, DefaultOptions())
+	fm, err := analyzer.NewFeatureMap(img, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := fm.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cached FeatureMap
+	if err := cached.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+
+	sizes := []image.Point{{250, 250}, {16, 9}}
+	expected, err := analyzer.FindBestCrops(img, sizes, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	topCrops, err := analyzer.FindBestCropsInFeatureMap(&cached, sizes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for idx := range sizes {
+		if topCrops[idx] != expected[idx] {
+			t.Errorf("size %v: expected %+v, got %+v", sizes[idx], expected[idx], topCrops[idx])
+		}
+	}
+
+	fm, err = analyzer.NewFeatureMap(img, []BoostRegion{
+		{X: 10, Y: 10, Width: 50, Height: 50, Weight: -1},
+		{X: 300, Y: 20, Width: 40, Height: 40, Required: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err = fm.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cached.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if cached.Penalty == nil || !reflect.DeepEqual(cached.Penalty.Pix, fm.Penalty.Pix) {
+		t.Errorf("expected the penalty map to survive encoding")
+	}
+	if cached.Required != image.Rect(300, 20, 340, 60) {
+		t.Errorf("expected the required region to survive encoding, got %v", cached.Required)
+	}
+
+	if err := cached.UnmarshalBinary(data[:len(data)-1]); err != ErrInvalidFeatureMap {
+		t.Errorf("expected %v, got %v", ErrInvalidFeatureMap, err)
+	}
+	if _, err := analyzer.FindTopCropsInFeatureMap(&FeatureMap{}, 1, 1, 1, 1.0); err != ErrInvalidFeatureMap {
+		t.Errorf("expected %v, got %v", ErrInvalidFeatureMap, err)
+	}
+}
+
+func TestFeatureMapMalformedHeader(t *testing.T) {
+	fm := &FeatureMap{
+		Detail:     NewPlane(2, 2),
+		Skin:       NewPlane(2, 2),
+		Saturation: NewPlane(2, 2),
+		Boost:      NewPlane(2, 2),
+		Prescale:   1.0,
+		Bounds:     image.Rect(0, 0, 2, 2),
+	}
+	data, err := fm.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the size follows the magic and the bounds and required rectangles
+	offset := len(featureMapMagic) + 8*4
+	for _, size := range [][2]int32{{-1, 2}, {2, 0}, {65535, 65535}} {
+		malformed := append([]byte{}, data...)
+		binary.LittleEndian.PutUint32(malformed[offset:], uint32(size[0]))
+		binary.LittleEndian.PutUint32(malformed[offset+4:], uint32(size[1]))
+
+		var cached FeatureMap
+		if err := cached.UnmarshalBinary(malformed); err != ErrInvalidFeatureMap {
+			t.Errorf("size %v: expected %v, got %v", size, ErrInvalidFeatureMap, err)
+		}
+	}
+}
@@ -0,0 +1,212 @@
+/*
+ * Copyright (c) 2014-2017 Christian Muehlhaeuser
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+ *	Authors:
+ *		Christian Muehlhaeuser <muesli@gmail.com>
+ *		Michael Wendland <michael@michiwend.com>
+ *		Bjørn Erik Pedersen <bjorn.erik.pedersen@gmail.com>
+ */
+
+package smartcrop
+
+import (
+	"math"
+)
+
+const (
+	// integralBands is the number of bands per axis the importance inside a
+	// crop gets approximated with
+	integralBands = 16
+	// integralSamples is the number of samples per band and axis used to
+	// average the importance
+	integralSamples = 8
+)
+
+// integralScorer approximates score with summed-area tables of the feature
+// channels. The importance inside a crop gets approximated by a grid of
+// integralBands x integralBands cells with constant importance each, which
+// only depends on the options. The score of a crop then is a weighted sum of
+// cell sums that can be looked up in constant time, no matter the crop size.
+type integralScorer struct {
+	opts   *Options
+	width  int
+	height int
+
+	// summed-area tables of the score terms, (width+1) * (height+1) each
+	skin       []float64
+	detail     []float64
+	saturation []float64
+	boost      []float64
+	// nil without penalty regions
+	penalty []float64
+	// nil without additional detectors
+	extra []float64
+
+	// average importance per cell, integralBands * integralBands each
+	importance      []float64
+	boostImportance []float64
+}
+
+func newIntegralScorer(opts *Options, sample *scoreMap) *integralScorer {
+	width := sample.detail.Width
+	height := sample.detail.Height
+	n := (width + 1) * (height + 1)
+	s := &integralScorer{
+		opts:       opts,
+		width:      width,
+		height:     height,
+		skin:       make([]float64, n),
+		detail:     make([]float64, n),
+		saturation: make([]float64, n),
+		boost:      make([]float64, n),
+	}
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			det := float64(sample.detail.At(x, y))
+
+			i := (y+1)*(width+1) + x + 1
+			s.integrate(s.skin, i, float64(sample.skin.At(x, y))*(det+opts.SkinBias))
+			s.integrate(s.detail, i, det)
+			s.integrate(s.saturation, i, float64(sample.saturation.At(x, y))*(det+opts.SaturationBias))
+			s.integrate(s.boost, i, float64(sample.boost.At(x, y)))
+		}
+	}
+
+	if sample.penalty != nil {
+		s.penalty = make([]float64, n)
+		for y := 0; y < height; y++ {
+			for x := 0; x < width; x++ {
+				s.integrate(s.penalty, (y+1)*(width+1)+x+1, float64(sample.penalty.At(x, y)))
+			}
+		}
+	}
+
+	if sample.extra != nil {
+		s.extra = make([]float64, n)
+		for y := 0; y < height; y++ {
+			for x := 0; x < width; x++ {
+				s.integrate(s.extra, (y+1)*(width+1)+x+1, float64(sample.extra.At(x, y)))
+			}
+		}
+	}
+
+	s.importance, s.boostImportance = bandImportance(opts)
+	return s
+}
+
+// integrate stores the summed-area table entry at index i
+func (s *integralScorer) integrate(table []float64, i int, v float64) {
+	stride := s.width + 1
+	table[i] = v + table[i-1] + table[i-stride] - table[i-stride-1]
+}
+
+// sum returns the sum of the table over the sample pixels x0..x1-1, y0..y1-1
+func (s *integralScorer) sum(table []float64, x0, y0, x1, y1 int) float64 {
+	stride := s.width + 1
+	return table[y1*stride+x1] - table[y0*stride+x1] - table[y1*stride+x0] + table[y0*stride+x0]
+}
+
+// bandImportance averages the importance over every cell of the band grid
+func bandImportance(opts *Options) ([]float64, []float64) {
+	imp := make([]float64, integralBands*integralBands)
+	impBoost := make([]float64, integralBands*integralBands)
+
+	samples := integralBands * integralSamples
+	for v := 0; v < samples; v++ {
+		for u := 0; u < samples; u++ {
+			xf := (float64(u) + 0.5) / float64(samples)
+			yf := (float64(v) + 0.5) / float64(samples)
+			i, b := importanceAt(opts, xf, yf)
+
+			cell := v/integralSamples*integralBands + u/integralSamples
+			imp[cell] += i
+			impBoost[cell] += b
+		}
+	}
+
+	for cell := range imp {
+		imp[cell] /= integralSamples * integralSamples
+		impBoost[cell] /= integralSamples * integralSamples
+	}
+
+	return imp, impBoost
+}
+
+// bandEdges returns the first sample pixel of every band along one axis of
+// the crop, plus the end of the last band
+func (s *integralScorer) bandEdges(min, size, limit int) [integralBands + 1]int {
+	var edges [integralBands + 1]int
+	ds := float64(s.opts.ScoreDownSample)
+	for k := range edges {
+		// a sample pixel p covers the position p * ScoreDownSample
+		t := float64(min) + float64(size)*float64(k)/integralBands
+		edges[k] = int(math.Min(math.Max(math.Ceil(t/ds), 0), float64(limit)))
+	}
+
+	return edges
+}
+
+func (s *integralScorer) score(crop Crop) Score {
+	xs := s.bandEdges(crop.Min.X, crop.Dx(), s.width)
+	ys := s.bandEdges(crop.Min.Y, crop.Dy(), s.height)
+	score := Score{}
+
+	for v := 0; v < integralBands; v++ {
+		for u := 0; u < integralBands; u++ {
+			x0, x1 := xs[u], xs[u+1]
+			y0, y1 := ys[v], ys[v+1]
+			if x0 >= x1 || y0 >= y1 {
+				continue
+			}
+
+			cell := v*integralBands + u
+			imp := s.importance[cell]
+			score.Skin += s.sum(s.skin, x0, y0, x1, y1) * imp
+			score.Detail += s.sum(s.detail, x0, y0, x1, y1) * imp
+			score.Saturation += s.sum(s.saturation, x0, y0, x1, y1) * imp
+			score.Boost += s.sum(s.boost, x0, y0, x1, y1) * s.boostImportance[cell]
+			if s.extra != nil {
+				score.Extra += s.sum(s.extra, x0, y0, x1, y1) * imp
+			}
+		}
+	}
+
+	// everything outside of the crop has the same importance
+	x0, x1 := xs[0], xs[integralBands]
+	y0, y1 := ys[0], ys[integralBands]
+	if s.penalty != nil {
+		score.Penalty = s.sum(s.penalty, x0, y0, x1, y1) * penaltyImportance
+	}
+	outside := func(table []float64) float64 {
+		all := s.sum(table, 0, 0, s.width, s.height)
+		return (all - s.sum(table, x0, y0, x1, y1)) * s.opts.OutsideImportance
+	}
+	score.Skin += outside(s.skin)
+	score.Detail += outside(s.detail)
+	score.Saturation += outside(s.saturation)
+	score.Boost += outside(s.boost)
+	if s.extra != nil {
+		score.Extra += outside(s.extra)
+	}
+
+	return score
+}
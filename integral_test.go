@@ -0,0 +1,90 @@
+/*
+ * Copyright (c) 2014-2017 Christian Muehlhaeuser
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+ *	Authors:
+ *		Christian Muehlhaeuser <muesli@gmail.com>
+ *		Michael Wendland <michael@michiwend.com>
+ *		Bjørn Erik Pedersen <bjorn.erik.pedersen@gmail.com>
+ */
+
+package smartcrop
+
+import (
+	"image"
+	"math"
+	"testing"
+
+	"github.com/muesli/smartcrop/nfnt"
+)
+
+func TestIntegralScoring(t *testing.T) {
+	for _, file := range []string{"./examples/gopher.jpg", "./examples/goodtimes.jpg"} {
+		img := loadTestImage(t, file)
+
+		opts := DefaultOptions()
+		opts.MinScale = 0.7
+		analyzer := NewAnalyzerWithOptions(nfnt.NewDefaultResizer(), Logger{}, opts)
+		fm, err := analyzer.NewFeatureMap(img, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sample := downSample(&opts, fm)
+		scorer := newIntegralScorer(&opts, sample)
+
+		for _, size := range []image.Point{{1, 1}, {16, 9}, {9, 16}} {
+			scale := math.Min(float64(fm.Detail.Width)/float64(size.X), float64(fm.Detail.Height)/float64(size.Y))
+			cs := crops(&opts, fm.Detail.Bounds(), chop(float64(size.X)*scale), chop(float64(size.Y)*scale), opts.MinScale, image.Rectangle{})
+
+			// the deviation is bounded relative to the largest score
+			var maxScore, maxDeviation float64
+			var exact, approx Crop
+			var worst, approxExact float64
+			for idx, crop := range cs {
+				crop.Score = score(&opts, sample, crop)
+				e := crop.totalScore(&opts)
+				crop.Score = scorer.score(crop)
+				a := crop.totalScore(&opts)
+
+				maxScore = math.Max(maxScore, math.Abs(e))
+				maxDeviation = math.Max(maxDeviation, math.Abs(e-a))
+				if idx == 0 || e > exact.Score.Total {
+					exact = Crop{Rectangle: crop.Rectangle, Score: Score{Total: e}}
+				}
+				if idx == 0 || a > approx.Score.Total {
+					approx = Crop{Rectangle: crop.Rectangle, Score: Score{Total: a}}
+					approxExact = e
+				}
+				if idx == 0 || e < worst {
+					worst = e
+				}
+			}
+
+			if maxDeviation > maxScore*0.1 {
+				t.Errorf("%s %v: deviation %f exceeds 10%% of max score %f", file, size, maxDeviation, maxScore)
+			}
+			// near ties between distant crops may go either way, but the
+			// approximate pick has to be one of the best crops
+			if approxExact < worst+(exact.Score.Total-worst)*0.95 {
+				t.Errorf("%s %v: expected a crop scoring close to %v, got %v", file, size, exact.Rectangle, approx.Rectangle)
+			}
+		}
+	}
+}
@@ -0,0 +1,75 @@
+/*
+ * Copyright (c) 2014-2017 Christian Muehlhaeuser
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+ *	Authors:
+ *		Christian Muehlhaeuser <muesli@gmail.com>
+ *		Michael Wendland <michael@michiwend.com>
+ *		Bjørn Erik Pedersen <bjorn.erik.pedersen@gmail.com>
+ */
+
+package smartcrop
+
+import (
+	"image"
+	"image/color"
+
+	"github.com/muesli/smartcrop/options"
+)
+
+// maskCoverage returns the mask's luminance (0..1) at x, y. The mask gets
+// stretched over the region's rectangle.
+func (boost BoostRegion) maskCoverage(x, y int) float64 {
+	mb := boost.Mask.Bounds()
+	if mb.Empty() || boost.Width <= 0 || boost.Height <= 0 {
+		return 0
+	}
+
+	// nearest neighbour, the mask usually got resized to the region already
+	mx := mb.Min.X + (x-boost.X)*mb.Dx()/boost.Width
+	my := mb.Min.Y + (y-boost.Y)*mb.Dy()/boost.Height
+	if g, ok := boost.Mask.(*image.Gray); ok {
+		return float64(g.GrayAt(mx, my).Y) / 255.0
+	}
+
+	return float64(color.GrayModel.Convert(boost.Mask.At(mx, my)).(color.Gray).Y) / 255.0
+}
+
+// resizeMask resizes the region's mask to the region's size and converts it
+// to grayscale
+func resizeMask(resizer options.Resizer, boost BoostRegion) BoostRegion {
+	if boost.Mask == nil || boost.Width <= 0 || boost.Height <= 0 {
+		return boost
+	}
+
+	mask := boost.Mask
+	if mask.Bounds().Dx() != boost.Width || mask.Bounds().Dy() != boost.Height {
+		mask = resizer.Resize(mask, uint(boost.Width), uint(boost.Height))
+	}
+	gray := image.NewGray(image.Rect(0, 0, mask.Bounds().Dx(), mask.Bounds().Dy()))
+	for y := 0; y < gray.Rect.Dy(); y++ {
+		for x := 0; x < gray.Rect.Dx(); x++ {
+			gray.Set(x, y, mask.At(mask.Bounds().Min.X+x, mask.Bounds().Min.Y+y))
+		}
+	}
+	boost.Mask = gray
+
+	return boost
+}
@@ -0,0 +1,67 @@
+/*
+ * Copyright (c) 2014-2017 Christian Muehlhaeuser
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+ *	Authors:
+ *		Christian Muehlhaeuser <muesli@gmail.com>
+ *		Michael Wendland <michael@michiwend.com>
+ *		Bjørn Erik Pedersen <bjorn.erik.pedersen@gmail.com>
+ */
+
+package smartcrop
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/muesli/smartcrop/nfnt"
+)
+
+func TestSaliencyMask(t *testing.T) {
+	img := loadTestImage(t, testFile)
+
+	// a coarse mask marking the right quarter of the image as salient
+	mask := image.NewGray(image.Rect(0, 0, 8, 2))
+	for y := 0; y < 2; y++ {
+		for x := 6; x < 8; x++ {
+			mask.SetGray(x, y, color.Gray{255})
+		}
+	}
+
+	analyzer := NewAnalyzer(nfnt.NewDefaultResizer())
+	topCrop, err := analyzer.FindBestCrop(img, 250, 250, []BoostRegion{{Weight: 1.0, Mask: mask}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if topCrop.Max.X < 800 {
+		t.Errorf("expected crop %v to move towards the salient area", topCrop)
+	}
+
+	o := NewPlane(40, 10)
+	boost := resizeMask(nfnt.NewDefaultResizer(), BoostRegion{X: 0, Y: 0, Width: 40, Height: 10, Weight: 0.5, Mask: mask})
+	applyBoost(boost, o)
+	if a := o.At(39, 5); a != 0.5 {
+		t.Errorf("expected the mask to scale the weight, got %f", a)
+	}
+	if a := o.At(5, 5); a != 0 {
+		t.Errorf("expected no boost outside of the mask, got %f", a)
+	}
+}
@@ -0,0 +1,72 @@
+/*
+ * Copyright (c) 2014-2017 Christian Muehlhaeuser
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+ *	Authors:
+ *		Christian Muehlhaeuser <muesli@gmail.com>
+ *		Michael Wendland <michael@michiwend.com>
+ *		Bjørn Erik Pedersen <bjorn.erik.pedersen@gmail.com>
+ */
+
+package smartcrop
+
+import (
+	"image"
+	"testing"
+
+	"github.com/muesli/smartcrop/nfnt"
+)
+
+// TestRegression pins the crops of the example images. The old feature map
+// packed the features into uint8 channels: downsampling wrapped the sums
+// around, the Laplacian got clamped and negative edges were dropped. Its
+// crops are noted as previous.
+func TestRegression(t *testing.T) {
+	tests := []struct {
+		file     string
+		size     image.Point
+		expected image.Rectangle
+		previous image.Rectangle
+	}{
+		{"./examples/gopher.jpg", image.Pt(250, 250), image.Rect(115, 0, 399, 284), image.Rect(115, 0, 399, 284)},
+		{"./examples/gopher.jpg", image.Pt(16, 9), image.Rect(26, 0, 531, 284), image.Rect(26, 0, 531, 284)},
+		{"./examples/gopher.jpg", image.Pt(9, 16), image.Rect(142, 0, 301, 284), image.Rect(150, 0, 310, 284)},
+		{"./examples/gopher.jpg", image.Pt(4, 3), image.Rect(88, 0, 467, 284), image.Rect(88, 0, 467, 284)},
+		// the detail of the debug visualization in the middle now outweighs
+		// the portrait, which only won due to the wrapped sums
+		{"./examples/goodtimes.jpg", image.Pt(250, 250), image.Rect(337, 0, 621, 284), image.Rect(8, 0, 292, 284)},
+		{"./examples/goodtimes.jpg", image.Pt(16, 9), image.Rect(355, 0, 859, 284), image.Rect(363, 0, 868, 284)},
+		{"./examples/goodtimes.jpg", image.Pt(9, 16), image.Rect(399, 0, 559, 284), image.Rect(44, 0, 204, 284)},
+		{"./examples/goodtimes.jpg", image.Pt(4, 3), image.Rect(301, 0, 680, 284), image.Rect(8, 0, 387, 284)},
+	}
+
+	analyzer := NewAnalyzer(nfnt.NewDefaultResizer())
+	for _, test := range tests {
+		img := loadTestImage(t, test.file)
+
+		topCrop, err := analyzer.FindBestCrop(img, test.size.X, test.size.Y, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if topCrop != test.expected {
+			t.Errorf("%s %v: expected %v (previously %v), got %v", test.file, test.size, test.expected, test.previous, topCrop)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+/*
+ * Copyright (c) 2014-2017 Christian Muehlhaeuser
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+ *	Authors:
+ *		Christian Muehlhaeuser <muesli@gmail.com>
+ *		Michael Wendland <michael@michiwend.com>
+ *		Bjørn Erik Pedersen <bjorn.erik.pedersen@gmail.com>
+ */
+
+package smartcrop
+
+import (
+	"context"
+	"image"
+	"math"
+	"sort"
+)
+
+// SearchStrategy selects how the candidate crops get enumerated.
+type SearchStrategy int
+
+const (
+	// SearchExhaustive scores a dense grid of crops using Step and ScaleStep.
+	SearchExhaustive SearchStrategy = iota
+	// SearchCoarseToFine scores a coarse grid of crops using CoarseStep and
+	// CoarseScaleStep first, then repeatedly refines the RefineTopK best
+	// crops with halved steps, down to a precision of one pixel.
+	SearchCoarseToFine
+)
+
+// scoreFunc scores the given crops in place
+type scoreFunc func(cs []Crop) error
+
+// searchCoarseToFine returns all crops it scored, in the order they were scored
+func searchCoarseToFine(ctx context.Context, opts *Options, bounds image.Rectangle, cropWidth, cropHeight, realMinScale float64, required image.Rectangle, scoreAll scoreFunc) ([]Crop, error) {
+	width := bounds.Dx()
+	height := bounds.Dy()
+	cropW, cropH := cropSize(bounds, cropWidth, cropHeight)
+
+	step := opts.CoarseStep
+	scaleStep := opts.CoarseScaleStep
+	coarse := *opts
+	coarse.Step = step
+	coarse.ScaleStep = scaleStep
+
+	res := crops(&coarse, bounds, cropWidth, cropHeight, realMinScale, required)
+	if err := scoreAll(res); err != nil {
+		return nil, err
+	}
+
+	seen := map[image.Rectangle]bool{}
+	scales := map[image.Rectangle]float64{}
+	for _, crop := range res {
+		seen[crop.Rectangle] = true
+		scales[crop.Rectangle] = math.Min(float64(crop.Dx())/cropW, float64(crop.Dy())/cropH)
+	}
+
+	for step > 1 {
+		step = (step + 1) / 2
+		scaleStep /= 2
+
+		best := make([]Crop, len(res))
+		copy(best, res)
+		sort.SliceStable(best, func(i, j int) bool {
+			return best[i].Score.Total > best[j].Score.Total
+		})
+		if len(best) > opts.RefineTopK {
+			best = best[:opts.RefineTopK]
+		}
+
+		var refined []Crop
+		for _, crop := range best {
+			scale := scales[crop.Rectangle]
+			for _, s := range []float64{scale, scale + scaleStep, scale - scaleStep} {
+				s = math.Min(math.Max(s, realMinScale), opts.MaxScale)
+				w, h := int(cropW*s), int(cropH*s)
+				origins, ok := feasibleOrigins(required, w, h, width, height)
+				if !ok {
+					continue
+				}
+
+				for dy := -step; dy <= step; dy += step {
+					for dx := -step; dx <= step; dx += step {
+						x := clamp(crop.Min.X+dx, origins.Min.X, origins.Max.X)
+						y := clamp(crop.Min.Y+dy, origins.Min.Y, origins.Max.Y)
+						r := image.Rect(x, y, x+w, y+h)
+						if seen[r] {
+							continue
+						}
+
+						seen[r] = true
+						scales[r] = s
+						refined = append(refined, Crop{Rectangle: r})
+					}
+				}
+			}
+		}
+
+		if err := scoreAll(refined); err != nil {
+			return nil, err
+		}
+		res = append(res, refined...)
+	}
+
+	return res, nil
+}
+
+func clamp(v, min, max int) int {
+	if v > max {
+		v = max
+	}
+	if v < min {
+		v = min
+	}
+	return v
+}
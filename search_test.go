@@ -0,0 +1,64 @@
+/*
+ * Copyright (c) 2014-2017 Christian Muehlhaeuser
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+ *	Authors:
+ *		Christian Muehlhaeuser <muesli@gmail.com>
+ *		Michael Wendland <michael@michiwend.com>
+ *		Bjørn Erik Pedersen <bjorn.erik.pedersen@gmail.com>
+ */
+
+package smartcrop
+
+import (
+	"image"
+	"testing"
+
+	"github.com/muesli/smartcrop/nfnt"
+)
+
+func TestCoarseToFine(t *testing.T) {
+	for _, file := range []string{"./examples/gopher.jpg", "./examples/goodtimes.jpg"} {
+		img := loadTestImage(t, file)
+
+		for _, size := range []image.Point{{1, 1}, {16, 9}, {9, 16}} {
+			opts := DefaultOptions()
+			opts.MinScale = 0.7
+			exhaustive, err := NewAnalyzerWithOptions(nfnt.NewDefaultResizer(), Logger{}, opts).FindTopCrops(img, size.X, size.Y, nil, 1<<20, 1.0)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			opts.Search = SearchCoarseToFine
+			refined, err := NewAnalyzerWithOptions(nfnt.NewDefaultResizer(), Logger{}, opts).FindTopCrops(img, size.X, size.Y, nil, 1<<20, 1.0)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// all scored crops get returned, so their number is the number of score calls
+			if len(refined) >= len(exhaustive) {
+				t.Errorf("%s %v: expected less than %d scored crops, got %d", file, size, len(exhaustive), len(refined))
+			}
+			if refined[0].Score.Total < exhaustive[0].Score.Total {
+				t.Errorf("%s %v: expected a score of at least %f, got %f", file, size, exhaustive[0].Score.Total, refined[0].Score.Total)
+			}
+		}
+	}
+}
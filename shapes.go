@@ -0,0 +1,106 @@
+/*
+ * Copyright (c) 2014-2017 Christian Muehlhaeuser
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+ *	Authors:
+ *		Christian Muehlhaeuser <muesli@gmail.com>
+ *		Michael Wendland <michael@michiwend.com>
+ *		Bjørn Erik Pedersen <bjorn.erik.pedersen@gmail.com>
+ */
+
+package smartcrop
+
+import (
+	"math"
+)
+
+// BoostShape determines how a BoostRegion's weight gets distributed within
+// its bounding rectangle
+type BoostShape int
+
+const (
+	// ShapeRectangle applies the full weight to the whole rectangle
+	ShapeRectangle BoostShape = iota
+	// ShapeEllipse applies the full weight to the ellipse inscribed in the
+	// rectangle
+	ShapeEllipse
+	// ShapeFeathered applies the full weight to the center of the rectangle
+	// and lets it fade out towards the edges with a Gaussian falloff
+	ShapeFeathered
+)
+
+// defaultFalloff is the falloff of feathered regions, relative to the smaller
+// region dimension, if none was given
+const defaultFalloff = 0.25
+
+// coverage returns the share (0..1) of the region's weight that applies to
+// the pixel at x, y
+func (boost BoostRegion) coverage(x, y int) float64 {
+	cov := boost.shapeCoverage(x, y)
+	if cov == 0 || boost.Mask == nil {
+		return cov
+	}
+
+	return cov * boost.maskCoverage(x, y)
+}
+
+// shapeCoverage returns the share of the weight at x, y due to the region's
+// shape
+func (boost BoostRegion) shapeCoverage(x, y int) float64 {
+	// pixel centers
+	px := float64(x) + 0.5
+	py := float64(y) + 0.5
+	x0, y0 := float64(boost.X), float64(boost.Y)
+	x1, y1 := x0+float64(boost.Width), y0+float64(boost.Height)
+	if px < x0 || px > x1 || py < y0 || py > y1 {
+		return 0
+	}
+
+	switch boost.Shape {
+	case ShapeEllipse:
+		rx, ry := float64(boost.Width)/2, float64(boost.Height)/2
+		dx, dy := (px-x0-rx)/rx, (py-y0-ry)/ry
+		if dx*dx+dy*dy > 1 {
+			return 0
+		}
+		return 1
+
+	case ShapeFeathered:
+		falloff := boost.Falloff
+		if falloff <= 0 {
+			falloff = defaultFalloff * math.Min(float64(boost.Width), float64(boost.Height))
+		}
+		if falloff <= 0 {
+			return 1
+		}
+
+		// distance to the core, which is the rectangle shrunk by the falloff
+		cx0, cx1 := math.Min(x0+falloff, (x0+x1)/2), math.Max(x1-falloff, (x0+x1)/2)
+		cy0, cy1 := math.Min(y0+falloff, (y0+y1)/2), math.Max(y1-falloff, (y0+y1)/2)
+		dx := math.Max(math.Max(cx0-px, px-cx1), 0)
+		dy := math.Max(math.Max(cy0-py, py-cy1), 0)
+
+		// the falloff spans two standard deviations
+		sigma := falloff / 2
+		return math.Exp(-(dx*dx + dy*dy) / (2 * sigma * sigma))
+	}
+
+	return 1
+}
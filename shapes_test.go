@@ -0,0 +1,74 @@
+/*
+ * Copyright (c) 2014-2017 Christian Muehlhaeuser
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+ *	Authors:
+ *		Christian Muehlhaeuser <muesli@gmail.com>
+ *		Michael Wendland <michael@michiwend.com>
+ *		Bjørn Erik Pedersen <bjorn.erik.pedersen@gmail.com>
+ */
+
+package smartcrop
+
+import (
+	"testing"
+)
+
+func TestBoostShapes(t *testing.T) {
+	region := BoostRegion{X: 10, Y: 10, Width: 40, Height: 20, Weight: 1.0}
+
+	o := NewPlane(60, 40)
+	applyBoost(region, o)
+	if o.At(10, 10) != 1 || o.At(49, 29) != 1 || o.At(50, 30) != 0 {
+		t.Errorf("expected rectangles to cover their whole area")
+	}
+
+	region.Shape = ShapeEllipse
+	o = NewPlane(60, 40)
+	applyBoost(region, o)
+	if o.At(30, 20) != 1 || o.At(10, 20) != 1 || o.At(30, 10) != 1 {
+		t.Errorf("expected the ellipse to cover its center and axes")
+	}
+	if o.At(10, 10) != 0 || o.At(49, 29) != 0 {
+		t.Errorf("expected the ellipse to leave out the corners")
+	}
+
+	region.Shape = ShapeFeathered
+	region.Falloff = 8
+	o = NewPlane(60, 40)
+	applyBoost(region, o)
+	if o.At(30, 20) != 1 {
+		t.Errorf("expected the feathered core to get the full weight, got %f", o.At(30, 20))
+	}
+	for x := 11; x <= 18; x++ {
+		if o.At(x, 20) < o.At(x-1, 20) {
+			t.Errorf("expected the weight to rise towards the core at %d", x)
+		}
+	}
+	if edge := o.At(10, 20); edge == 0 || edge >= 1 {
+		t.Errorf("expected a faded edge, got %f", edge)
+	}
+
+	// faded edges don't lower overlapping boosts
+	applyBoost(BoostRegion{X: 0, Y: 0, Width: 20, Height: 20, Weight: 1.0, Shape: ShapeFeathered}, o)
+	if o.At(19, 19) != 1 {
+		t.Errorf("expected the earlier boost to be kept, got %f", o.At(19, 19))
+	}
+}
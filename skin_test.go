@@ -0,0 +1,123 @@
+/*
+ * Copyright (c) 2014-2017 Christian Muehlhaeuser
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+ *	Authors:
+ *		Christian Muehlhaeuser <muesli@gmail.com>
+ *		Michael Wendland <michael@michiwend.com>
+ *		Bjørn Erik Pedersen <bjorn.erik.pedersen@gmail.com>
+ */
+
+package smartcrop
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+// skinTones are photographed skin colors from very light to very dark
+// complexions. The swatches of skin tone scales are no good here, their
+// lightest tones lack the redness of skin and match cream paper.
+var skinTones = []color.RGBA{
+	{247, 215, 196, 255},
+	{236, 196, 170, 255},
+	{241, 194, 125, 255},
+	{224, 172, 105, 255},
+	{198, 134, 66, 255},
+	{160, 120, 80, 255},
+	{141, 85, 36, 255},
+	{110, 70, 50, 255},
+	{75, 50, 38, 255},
+	{50, 36, 30, 255},
+}
+
+// skinFixture renders the color under varying light, from 50% to 100%
+func skinFixture(c color.RGBA) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, 64, 8))
+	for x := 0; x < 64; x++ {
+		f := 0.5 + 0.5*float64(x)/63
+		shaded := color.RGBA{
+			uint8(math.Min(float64(c.R)*f, 255)),
+			uint8(math.Min(float64(c.G)*f, 255)),
+			uint8(math.Min(float64(c.B)*f, 255)),
+			255,
+		}
+		for y := 0; y < 8; y++ {
+			img.SetRGBA(x, y, shaded)
+		}
+	}
+	return img
+}
+
+// skinDetection returns the share of pixels detected as skin and their
+// average strength
+func skinDetection(opts *Options, c color.RGBA) (float64, float64) {
+	p := skinDetect(opts, skinFixture(c))
+	var detected, strength float64
+	for _, v := range p.Pix {
+		if v > 0 {
+			detected++
+		}
+		strength += float64(v)
+	}
+	return detected / float64(len(p.Pix)), strength / float64(len(p.Pix))
+}
+
+func TestSkinTones(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		opts Options
+	}{
+		{"default", DefaultOptions()},
+		{"perceptual", PerceptualOptions()},
+	} {
+		minStrength, maxStrength := math.Inf(1), 0.0
+		for idx, tone := range skinTones {
+			rate, strength := skinDetection(&test.opts, tone)
+			if rate < 0.8 {
+				t.Errorf("%s tone %d: expected a detection rate of at least 0.8, got %.2f", test.name, idx+1, rate)
+			}
+			minStrength = math.Min(minStrength, strength)
+			maxStrength = math.Max(maxStrength, strength)
+		}
+		if minStrength < 0.4*maxStrength {
+			t.Errorf("%s: expected comparable detection across tones, got %.2f to %.2f", test.name, minStrength, maxStrength)
+		}
+
+		for _, c := range []color.RGBA{
+			{128, 128, 128, 255}, // gray
+			{240, 240, 240, 255}, // white
+			{120, 170, 230, 255}, // sky
+			{60, 120, 40, 255},   // foliage
+			{200, 40, 40, 255},   // red
+			{200, 190, 170, 255}, // beige
+			{230, 220, 200, 255}, // cream
+			{245, 240, 225, 255}, // paper
+			{222, 184, 135, 255}, // pine
+			{130, 50, 35, 255},   // mahogany
+		} {
+			if rate, _ := skinDetection(&test.opts, c); rate > 0 {
+				t.Errorf("%s: expected %v not to be detected as skin, got a rate of %.2f", test.name, c, rate)
+			}
+		}
+	}
+}
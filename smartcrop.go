@@ -32,14 +32,21 @@ Jonas Wagner's smartcrop.js https://github.com/jwagner/smartcrop.js
 package smartcrop
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"image"
 	"image/color"
 	"io/ioutil"
 	"log"
 	"math"
+	"runtime"
+	"sort"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/muesli/smartcrop/colormath"
 	"github.com/muesli/smartcrop/options"
 
 	"golang.org/x/image/draw"
@@ -48,35 +55,212 @@ import (
 var (
 	// ErrInvalidDimensions gets returned when the supplied dimensions are invalid
 	ErrInvalidDimensions = errors.New("Expect either a height or width")
-
-	skinColor = [3]float64{0.78, 0.57, 0.44}
+	// ErrInvalidOptions gets returned when the analyzer options can't be used
+	ErrInvalidOptions = errors.New("Step sizes, ScoreDownSample and RefineTopK must be positive, max blend ratios within 0..1")
+	// ErrNoFeasibleCrop gets returned when no crop of the requested aspect
+	// ratio can contain all required boost regions
+	ErrNoFeasibleCrop = errors.New("No crop of the requested aspect ratio contains all required regions")
+	// ErrInvalidFeatureMap gets returned when a feature map is empty or can't be decoded
+	ErrInvalidFeatureMap = errors.New("Invalid feature map")
 )
 
-const (
-	detailWeight            = 0.2
-	skinBias                = 0.01
-	skinBrightnessMin       = 0.2
-	skinBrightnessMax       = 1.0
-	skinThreshold           = 0.8
-	skinWeight              = 1.8
-	saturationBrightnessMin = 0.05
-	saturationBrightnessMax = 0.9
-	saturationThreshold     = 0.4
-	saturationBias          = 0.2
-	saturationWeight        = 0.3
-	scoreDownSample         = 4 // step * minscale rounded down to the next power of two should be good
-	step                    = 8
-	scaleStep               = 0.1
-	minScale                = 1.0
-	maxScale                = 1.0
-	edgeRadius              = 0.4
-	edgeWeight              = -20.0
-	outsideImportance       = -0.5
-	boostWeight             = 200.0
-	ruleOfThirds            = true
-	prescale                = true
-	prescaleMin             = 256.00
-)
+// Options contains the tuning knobs used by the analyzer. Start from
+// DefaultOptions and change what you need, the zero value is not usable.
+type Options struct {
+	// DetailWeight is the weight of the edge (detail) feature in the final score.
+	DetailWeight float64
+	// SkinColors are the normalized reference skin colors, by default
+	// covering very light to very dark complexions. A pixel's skin similarity
+	// is the one to the closest.
+	SkinColors [][3]float64
+	// SkinBias is added to the detail value when weighting skin.
+	SkinBias float64
+	// SkinBrightnessMin and SkinBrightnessMax limit the lightness (0..1)
+	// range of skin, which is the CIELAB lightness with ColorMathPerceptual.
+	SkinBrightnessMin float64
+	SkinBrightnessMax float64
+	// SkinChromaMin is the minimum CIELAB chroma of skin, which keeps grays
+	// and off-white surfaces out. 0 disables the check.
+	SkinChromaMin float64
+	// SkinThreshold is the minimum similarity to SkinColors to count as skin.
+	SkinThreshold float64
+	// SkinWeight is the weight of the skin feature in the final score.
+	SkinWeight float64
+	// SaturationBrightnessMin and SaturationBrightnessMax limit the lightness
+	// range of saturated pixels.
+	SaturationBrightnessMin float64
+	SaturationBrightnessMax float64
+	// SaturationThreshold is the minimum saturation to count as saturated.
+	SaturationThreshold float64
+	// SaturationBias is added to the detail value when weighting saturation.
+	SaturationBias float64
+	// SaturationWeight is the weight of the saturation feature in the final score.
+	SaturationWeight float64
+	// ScoreDownSample is the factor the feature map gets reduced by before
+	// scoring. Step * MinScale rounded down to the next power of two should be good.
+	ScoreDownSample int
+	// DetailMaxRatio, SkinMaxRatio and SaturationMaxRatio (0..1) blend the
+	// maximum of every downsampled block into its average, which preserves
+	// small details. 0 keeps the plain average.
+	DetailMaxRatio     float64
+	SkinMaxRatio       float64
+	SaturationMaxRatio float64
+	// Step is the distance in pixels between two candidate crops.
+	Step int
+	// ScaleStep is the decrement between two candidate crop scales.
+	ScaleStep float64
+	// MinScale and MaxScale limit the size of candidate crops relative to
+	// the largest crop fitting the image.
+	MinScale float64
+	MaxScale float64
+	// EdgeRadius is the relative distance from the crop border where the
+	// edge penalty starts.
+	EdgeRadius float64
+	// EdgeWeight is the weight of the edge penalty.
+	EdgeWeight float64
+	// OutsideImportance is the importance of pixels outside the crop.
+	OutsideImportance float64
+	// BoostWeight is the weight of boost regions in the final score.
+	BoostWeight float64
+	// RuleOfThirds favors features on the thirds lines of a crop.
+	RuleOfThirds bool
+	// Prescale shrinks the image before analysis for faster processing.
+	Prescale bool
+	// PrescaleMin is the size the shorter image side gets prescaled to.
+	PrescaleMin float64
+	// Search selects the strategy used to enumerate candidate crops.
+	Search SearchStrategy
+	// CoarseStep and CoarseScaleStep are the initial steps of the
+	// SearchCoarseToFine strategy.
+	CoarseStep      int
+	CoarseScaleStep float64
+	// RefineTopK is the number of crops SearchCoarseToFine refines in every
+	// round.
+	RefineTopK int
+	// IntegralScoring approximates the crop scores using summed-area tables
+	// instead of walking the whole feature map for every candidate. This is
+	// a lot faster, but may pick a slightly different crop.
+	IntegralScoring bool
+	// ParallelScoring scores the candidate crops concurrently. The results
+	// are identical to the serial scoring.
+	ParallelScoring bool
+	// Workers limits the number of goroutines used by ParallelScoring,
+	// defaults to GOMAXPROCS.
+	Workers int
+	// ColorMath selects the color calculations of the feature detection.
+	ColorMath ColorMath
+	// EdgeOperator selects the operator of the detail feature.
+	EdgeOperator EdgeOperator
+	// EdgeBlur is the sigma of a Gaussian blur applied before edge
+	// detection, which suppresses noise. 0 disables it.
+	EdgeBlur float64
+	// EdgeScales is the number of pyramid levels the edges get detected on.
+	// The strongest response wins, so coarse levels add large structures.
+	EdgeScales int
+	// Detectors are additional feature detectors, e.g. for text or products.
+	// Their weighted planes count like the detail feature.
+	Detectors []Detector
+	// FaceDetector, if set, runs on every analyzed image after prescaling,
+	// so faces need to be found at PrescaleMin. The faces it finds get added
+	// to the boost regions.
+	FaceDetector FaceDetector
+}
+
+// DefaultOptions returns the options used by NewAnalyzer.
+func DefaultOptions() Options {
+	return Options{
+		DetailWeight:            0.2,
+		SkinColors:              append([][3]float64(nil), defaultSkinColors...),
+		SkinBias:                0.01,
+		SkinBrightnessMin:       0.06,
+		SkinBrightnessMax:       1.0,
+		SkinChromaMin:           5,
+		SkinThreshold:           0.96,
+		SkinWeight:              1.8,
+		SaturationBrightnessMin: 0.05,
+		SaturationBrightnessMax: 0.9,
+		SaturationThreshold:     0.4,
+		SaturationBias:          0.2,
+		SaturationWeight:        0.3,
+		ScoreDownSample:         4,
+		DetailMaxRatio:          0.3,
+		SkinMaxRatio:            0.5,
+		SaturationMaxRatio:      0,
+		Step:                    8,
+		ScaleStep:               0.1,
+		MinScale:                1.0,
+		MaxScale:                1.0,
+		EdgeRadius:              0.4,
+		EdgeWeight:              -20.0,
+		OutsideImportance:       -0.5,
+		BoostWeight:             200.0,
+		RuleOfThirds:            true,
+		Prescale:                true,
+		PrescaleMin:             256.00,
+		CoarseStep:              32,
+		CoarseScaleStep:         0.2,
+		RefineTopK:              3,
+		EdgeScales:              1,
+	}
+}
+
+// defaultSkinColors are the normalized colors of photographed skin, lightest
+// first. Their redness tells them apart from beige, cream and wood surfaces.
+var defaultSkinColors = [][3]float64{
+	{0.655, 0.560, 0.507}, // very light
+	{0.678, 0.557, 0.480}, // light
+	{0.733, 0.576, 0.362}, // light, warm
+	{0.743, 0.557, 0.371}, // medium
+	{0.798, 0.540, 0.266}, // medium, warm
+	{0.837, 0.504, 0.214}, // brown
+	{0.788, 0.501, 0.358}, // dark brown
+	{0.767, 0.511, 0.388}, // dark
+	{0.735, 0.525, 0.430}, // very dark
+}
+
+// PerceptualOptions returns the default options switched to
+// ColorMathPerceptual.
+func PerceptualOptions() Options {
+	opts := DefaultOptions()
+	opts.ColorMath = ColorMathPerceptual
+	return opts
+}
+
+func (opts Options) validate() error {
+	if opts.Step <= 0 || opts.ScaleStep <= 0 || opts.ScoreDownSample <= 0 {
+		return ErrInvalidOptions
+	}
+	if opts.Search == SearchCoarseToFine && (opts.CoarseStep <= 0 || opts.CoarseScaleStep <= 0 || opts.RefineTopK <= 0) {
+		return ErrInvalidOptions
+	}
+	for _, ratio := range []float64{opts.DetailMaxRatio, opts.SkinMaxRatio, opts.SaturationMaxRatio} {
+		if ratio < 0 || ratio > 1 {
+			return ErrInvalidOptions
+		}
+	}
+	return nil
+}
+
+// BoostRegionError gets returned when a boost region can't be used
+type BoostRegionError struct {
+	// Index of the region in the boosts slice
+	Index int
+	// Rectangle of the region as it was passed in
+	Rectangle image.Rectangle
+	Reason    string
+}
+
+func (e *BoostRegionError) Error() string {
+	return fmt.Sprintf("Invalid boost region %d %v: %s", e.Index, e.Rectangle, e.Reason)
+}
+
+// penaltyImportance is the importance of penalty regions inside a crop,
+// matching the scale of the boost importance. Outside they don't count.
+const penaltyImportance = 4.0
+
+// cancelCheckInterval is the number of scored crops between two checks of
+// the context
+const cancelCheckInterval = 64
 
 // Analyzer interface analyzes its struct and returns the best possible crop with the given
 // width and height returns an error if invalid
@@ -84,12 +268,55 @@ type Analyzer interface {
 	FindBestCrop(img image.Image, width, height int, boosts []BoostRegion) (image.Rectangle, error)
 }
 
+// ScoringAnalyzer is an Analyzer which also exposes the scores and feature
+// maps of its analysis. The analyzers returned by this package implement it.
+type ScoringAnalyzer interface {
+	Analyzer
+	// FindBestCropContext works like FindBestCrop, but aborts the analysis
+	// with the context's error once the context is done
+	FindBestCropContext(ctx context.Context, img image.Image, width, height int, boosts []BoostRegion) (image.Rectangle, error)
+	// FindBestCropWithScore works like FindBestCrop, but returns the winning
+	// crop together with its score. The rectangle is in original image
+	// coordinates, the score is computed on the prescaled image
+	FindBestCropWithScore(img image.Image, width, height int, boosts []BoostRegion) (Crop, error)
+	// FindTopCrops returns up to n of the highest scoring crops, best first.
+	// Crops overlapping a better one by more than the given intersection
+	// over union ratio (0..1) are skipped, pass 1 to keep all of them
+	FindTopCrops(img image.Image, width, height int, boosts []BoostRegion, n int, overlap float64) ([]Crop, error)
+	// FindBestCrops returns the best crop for each of the given sizes, which
+	// may also be plain aspect ratios like 16x9. The image only gets analyzed
+	// once, which is a lot cheaper than calling FindBestCrop for every size
+	FindBestCrops(img image.Image, sizes []image.Point, boosts []BoostRegion) ([]Crop, error)
+	// NewFeatureMap analyzes the image and returns the resulting feature map,
+	// which can be kept around to find crops for other sizes later on
+	NewFeatureMap(img image.Image, boosts []BoostRegion) (*FeatureMap, error)
+	// FindTopCropsInFeatureMap works like FindTopCrops on an existing feature map
+	FindTopCropsInFeatureMap(fm *FeatureMap, width, height, n int, overlap float64) ([]Crop, error)
+	// FindBestCropsInFeatureMap works like FindBestCrops on an existing feature map
+	FindBestCropsInFeatureMap(fm *FeatureMap, sizes []image.Point) ([]Crop, error)
+}
+
+// BoostRegion is a region of the image whose importance gets raised by the
+// given Weight (0..1). A negative Weight (-1..0) marks a penalty region instead,
+// e.g. a watermark, which crops should rather leave out.
 type BoostRegion struct {
-	X 		int
-	Y 		int
-	Width 	int
-	Height 	int
-	Weight	float64
+	X      int
+	Y      int
+	Width  int
+	Height int
+	Weight float64
+	// Required regions must be fully contained by the crop, independent of
+	// their weight. ErrNoFeasibleCrop gets returned if that's impossible.
+	Required bool
+	// Shape of the region within its rectangle, ShapeRectangle by default
+	Shape BoostShape
+	// Falloff is the width in pixels of the fading edge of ShapeFeathered
+	// regions. Defaults to a quarter of the smaller region dimension.
+	Falloff float64
+	// Mask is an optional grayscale importance mask of any size, which gets
+	// resized to the region and scales its weight per pixel. A region with a
+	// mask but without a size covers the whole image.
+	Mask image.Image
 }
 
 // Score contains values that classify matches
@@ -98,6 +325,12 @@ type Score struct {
 	Saturation float64
 	Skin       float64
 	Boost      float64
+	// Penalty is the amount of penalty regions inside the crop
+	Penalty float64
+	// Extra is the weighted sum of the Options.Detectors terms
+	Extra float64
+	// Total is the weighted sum of the values above, normalized by the crop area
+	Total float64
 }
 
 // Crop contains results
@@ -114,10 +347,12 @@ type Logger struct {
 
 type smartcropAnalyzer struct {
 	logger Logger
+	opts   Options
 	options.Resizer
 }
 
-// NewAnalyzer returns a new Analyzer using the given Resizer.
+// NewAnalyzer returns a new Analyzer using the given Resizer. It also
+// implements ScoringAnalyzer.
 func NewAnalyzer(resizer options.Resizer) Analyzer {
 	logger := Logger{
 		DebugMode: false,
@@ -128,37 +363,169 @@ func NewAnalyzer(resizer options.Resizer) Analyzer {
 
 // NewAnalyzerWithLogger returns a new analyzer with the given Resizer and Logger.
 func NewAnalyzerWithLogger(resizer options.Resizer, logger Logger) Analyzer {
+	return NewAnalyzerWithOptions(resizer, logger, DefaultOptions())
+}
+
+// NewAnalyzerWithOptions returns a new analyzer with the given Resizer, Logger
+// and Options.
+func NewAnalyzerWithOptions(resizer options.Resizer, logger Logger, opts Options) ScoringAnalyzer {
 	if logger.Log == nil {
 		logger.Log = log.New(ioutil.Discard, "", 0)
 	}
 
-	return &smartcropAnalyzer{Resizer: resizer, logger: logger}
+	return &smartcropAnalyzer{Resizer: resizer, logger: logger, opts: opts}
 }
 
 func (o smartcropAnalyzer) FindBestCrop(img image.Image, width, height int, boosts []BoostRegion) (image.Rectangle, error) {
+	return o.FindBestCropContext(context.Background(), img, width, height, boosts)
+}
+
+func (o smartcropAnalyzer) FindBestCropContext(ctx context.Context, img image.Image, width, height int, boosts []BoostRegion) (image.Rectangle, error) {
+	topCrops, err := o.findTopCrops(ctx, img, width, height, boosts, 1, 1.0)
+	if err != nil || len(topCrops) == 0 {
+		return image.Rectangle{}, err
+	}
+
+	return topCrops[0].Rectangle, nil
+}
+
+func (o smartcropAnalyzer) FindBestCropWithScore(img image.Image, width, height int, boosts []BoostRegion) (Crop, error) {
+	topCrops, err := o.findTopCrops(context.Background(), img, width, height, boosts, 1, 1.0)
+	if err != nil || len(topCrops) == 0 {
+		return Crop{}, err
+	}
+
+	return topCrops[0], nil
+}
+
+func (o smartcropAnalyzer) FindTopCrops(img image.Image, width, height int, boosts []BoostRegion, n int, overlap float64) ([]Crop, error) {
+	return o.findTopCrops(context.Background(), img, width, height, boosts, n, overlap)
+}
+
+func (o smartcropAnalyzer) FindBestCrops(img image.Image, sizes []image.Point, boosts []BoostRegion) ([]Crop, error) {
+	for _, size := range sizes {
+		if size.X == 0 && size.Y == 0 {
+			return nil, ErrInvalidDimensions
+		}
+	}
+	if err := o.opts.validate(); err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	fm, err := o.analyseImage(ctx, img, boosts)
+	if err != nil {
+		return nil, err
+	}
+	return o.findBestCropsInFeatureMap(ctx, fm, sizes)
+}
+
+func (o smartcropAnalyzer) NewFeatureMap(img image.Image, boosts []BoostRegion) (*FeatureMap, error) {
+	if err := o.opts.validate(); err != nil {
+		return nil, err
+	}
+
+	return o.analyseImage(context.Background(), img, boosts)
+}
+
+func (o smartcropAnalyzer) FindTopCropsInFeatureMap(fm *FeatureMap, width, height, n int, overlap float64) ([]Crop, error) {
+	return o.findTopCropsInFeatureMap(context.Background(), fm, width, height, n, overlap)
+}
+
+func (o smartcropAnalyzer) FindBestCropsInFeatureMap(fm *FeatureMap, sizes []image.Point) ([]Crop, error) {
+	return o.findBestCropsInFeatureMap(context.Background(), fm, sizes)
+}
+
+func (o smartcropAnalyzer) findTopCrops(ctx context.Context, img image.Image, width, height int, boosts []BoostRegion, n int, overlap float64) ([]Crop, error) {
 	if width == 0 && height == 0 {
-		return image.Rectangle{}, ErrInvalidDimensions
+		return nil, ErrInvalidDimensions
+	}
+	if err := o.opts.validate(); err != nil {
+		return nil, err
+	}
+
+	fm, err := o.analyseImage(ctx, img, boosts)
+	if err != nil {
+		return nil, err
+	}
+	return o.findTopCropsInFeatureMap(ctx, fm, width, height, n, overlap)
+}
+
+func (o smartcropAnalyzer) findTopCropsInFeatureMap(ctx context.Context, fm *FeatureMap, width, height, n int, overlap float64) ([]Crop, error) {
+	if width == 0 && height == 0 {
+		return nil, ErrInvalidDimensions
+	}
+	if err := o.opts.validate(); err != nil {
+		return nil, err
+	}
+	if err := fm.validate(); err != nil {
+		return nil, err
+	}
+
+	sample := o.downSample(fm)
+	return o.topCrops(ctx, fm, sample, width, height, n, overlap)
+}
+
+func (o smartcropAnalyzer) findBestCropsInFeatureMap(ctx context.Context, fm *FeatureMap, sizes []image.Point) ([]Crop, error) {
+	for _, size := range sizes {
+		if size.X == 0 && size.Y == 0 {
+			return nil, ErrInvalidDimensions
+		}
+	}
+	if err := o.opts.validate(); err != nil {
+		return nil, err
+	}
+	if err := fm.validate(); err != nil {
+		return nil, err
+	}
+
+	sample := o.downSample(fm)
+	res := make([]Crop, len(sizes))
+	for idx, size := range sizes {
+		topCrops, err := o.topCrops(ctx, fm, sample, size.X, size.Y, 1, 1.0)
+		if err != nil {
+			return nil, err
+		}
+		if len(topCrops) > 0 {
+			res[idx] = topCrops[0]
+		}
+	}
+
+	return res, nil
+}
+
+// analyseImage prescales the image and runs the feature detection on it
+func (o smartcropAnalyzer) analyseImage(ctx context.Context, img image.Image, boosts []BoostRegion) (*FeatureMap, error) {
+	boosts, err := prepareBoosts(img.Bounds(), boosts)
+	if err != nil {
+		return nil, err
+	}
+
+	// the required regions are kept in original image coordinates
+	var required image.Rectangle
+	for _, boost := range boosts {
+		if boost.Required {
+			required = required.Union(boost.Rect().Add(img.Bounds().Min).Intersect(img.Bounds()))
+		}
 	}
 
 	// resize image for faster processing
-	scale := math.Min(float64(img.Bounds().Dx())/float64(width), float64(img.Bounds().Dy())/float64(height))
 	var lowimg *image.RGBA
 	var prescalefactor = 1.0
 
-	if prescale {
+	if o.opts.Prescale {
 		// if f := 1.0 / scale / minScale; f < 1.0 {
 		// prescalefactor = f
 		// }
-		if f := prescaleMin / math.Min(float64(img.Bounds().Dx()), float64(img.Bounds().Dy())); f < 1.0 {
+		if f := o.opts.PrescaleMin / math.Min(float64(img.Bounds().Dx()), float64(img.Bounds().Dy())); f < 1.0 {
 			prescalefactor = f
 			for idx, boost := range boosts {
-				boosts[idx] = BoostRegion{
-					X: int(float64(boost.X) * prescalefactor),
-					Y: int(float64(boost.Y) * prescalefactor),
-					Width:int(float64(boost.Width) * prescalefactor),
-					Height: int(float64(boost.Height) * prescalefactor),
-					Weight: boost.Weight,
-				}
+				boost.X = int(float64(boost.X) * prescalefactor)
+				boost.Y = int(float64(boost.Y) * prescalefactor)
+				boost.Width = int(float64(boost.Width) * prescalefactor)
+				boost.Height = int(float64(boost.Height) * prescalefactor)
+				boost.Falloff *= prescalefactor
+				boosts[idx] = boost
 			}
 
 			smallImg := o.Resize(
@@ -177,34 +544,174 @@ func (o smartcropAnalyzer) FindBestCrop(img image.Image, width, height int, boos
 	} else {
 		lowimg = ToRGBA(img)
 	}
+	// the analysis works on images at the origin, crops get moved back later
+	lowimg = rebase(lowimg)
+
+	// faces are detected on the prescaled image, which is a lot faster and
+	// yields boosts in the coordinates the analysis works with
+	if o.opts.FaceDetector != nil {
+		faces, err := o.opts.FaceDetector.DetectFaces(ctx, lowimg, nil, "")
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		if errs, ok := err.(FaceErrors); ok {
+			// the faces of the working detectors are still worth keeping
+			o.logger.Log.Println(errs)
+		} else if err != nil {
+			return nil, err
+		}
+		o.logger.Log.Printf("detected %d faces\n", len(faces))
+
+		faces, err = prepareBoosts(lowimg.Bounds(), faces)
+		if err != nil {
+			return nil, err
+		}
+		for _, face := range faces {
+			if face.Required {
+				required = required.Union(prescaleRect(face.Rect(), 1/prescalefactor).Add(img.Bounds().Min).Intersect(img.Bounds()))
+			}
+		}
+		boosts = append(boosts, faces...)
+	}
+
+	for idx, boost := range boosts {
+		boosts[idx] = resizeMask(o.Resizer, boost)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 
 	if o.logger.DebugMode {
 		writeImage("png", lowimg, "./smartcrop_prescale.png")
 	}
 
-	cropWidth, cropHeight := chop(float64(width)*scale*prescalefactor), chop(float64(height)*scale*prescalefactor)
-	realMinScale := math.Min(maxScale, math.Max(1.0/scale, minScale))
-
 	o.logger.Log.Printf("original resolution: %dx%d\n", img.Bounds().Dx(), img.Bounds().Dy())
+
+	fm, err := analyse(ctx, o.logger, &o.opts, lowimg, boosts)
+	if err != nil {
+		return nil, err
+	}
+	fm.Prescale = prescalefactor
+	fm.Bounds = img.Bounds()
+	fm.Required = required
+
+	return fm, nil
+}
+
+// prepareBoosts validates the boost regions and returns a copy of them relative
+// to the image's origin, which can be rescaled without touching the caller's
+// slice
+func prepareBoosts(bounds image.Rectangle, boosts []BoostRegion) ([]BoostRegion, error) {
+	res := make([]BoostRegion, len(boosts))
+	for idx, boost := range boosts {
+		if boost.Mask != nil && boost.Width == 0 && boost.Height == 0 {
+			boost.X, boost.Y = bounds.Min.X, bounds.Min.Y
+			boost.Width, boost.Height = bounds.Dx(), bounds.Dy()
+		}
+		if boost.Width <= 0 || boost.Height <= 0 {
+			return nil, &BoostRegionError{Index: idx, Rectangle: boost.Rect(), Reason: "Width and Height must be positive"}
+		}
+
+		boost.X -= bounds.Min.X
+		boost.Y -= bounds.Min.Y
+		res[idx] = boost
+	}
+
+	return res, nil
+}
+
+// scoreMap is a feature map reduced for scoring
+type scoreMap struct {
+	detail     *Plane
+	skin       *Plane
+	saturation *Plane
+	boost      *Plane
+	// penalty is nil if there are no penalty regions
+	penalty *Plane
+	// extra is nil if there are no additional detectors
+	extra *Plane
+}
+
+// downSample reduces the feature map for scoring
+func (o smartcropAnalyzer) downSample(fm *FeatureMap) *scoreMap {
+	now := time.Now()
+	sample := downSample(&o.opts, fm)
+	o.logger.Log.Println("Time elapsed downsample:", time.Since(now))
+	if o.logger.DebugMode {
+		debugOutput(true, (&FeatureMap{Detail: sample.detail, Skin: sample.skin, Saturation: sample.saturation, Boost: sample.boost}).Image(), "downSample")
+	}
+
+	return sample
+}
+
+// topCrops returns the n best crops with the given aspect ratio in original
+// image coordinates
+func (o smartcropAnalyzer) topCrops(ctx context.Context, fm *FeatureMap, sample *scoreMap, width, height, n int, overlap float64) ([]Crop, error) {
+	scale := math.Min(float64(fm.Bounds.Dx())/float64(width), float64(fm.Bounds.Dy())/float64(height))
+	cropWidth, cropHeight := chop(float64(width)*scale*fm.Prescale), chop(float64(height)*scale*fm.Prescale)
+	realMinScale := math.Min(o.opts.MaxScale, math.Max(1.0/scale, o.opts.MinScale))
+
 	o.logger.Log.Printf("scale: %f, cropw: %f, croph: %f, minscale: %f\n", scale, cropWidth, cropHeight, realMinScale)
 
-	topCrop, err := analyse(o.logger, lowimg, cropWidth, cropHeight, realMinScale, boosts)
+	cs, err := scoreCrops(ctx, o.logger, &o.opts, fm, sample, cropWidth, cropHeight, realMinScale)
 	if err != nil {
-		return topCrop, err
+		return nil, err
+	}
+	if len(cs) == 0 && !fm.Required.Empty() {
+		return nil, ErrNoFeasibleCrop
+	}
+
+	topCrops := suppressOverlaps(cs, n, overlap)
+	for idx, topCrop := range topCrops {
+		topCrop.Min.X = int(chop(float64(topCrop.Min.X) / fm.Prescale))
+		topCrop.Min.Y = int(chop(float64(topCrop.Min.Y) / fm.Prescale))
+		topCrop.Max.X = int(chop(float64(topCrop.Max.X) / fm.Prescale))
+		topCrop.Max.Y = int(chop(float64(topCrop.Max.Y) / fm.Prescale))
+		topCrops[idx].Rectangle = containRequired(topCrop.Canon().Add(fm.Bounds.Min), fm.Required, fm.Bounds)
+	}
+
+	return topCrops, nil
+}
+
+// containRequired shifts a crop by the few pixels it may have lost on the
+// required regions while scaling it back to the original image
+func containRequired(r, required, bounds image.Rectangle) image.Rectangle {
+	if required.Empty() {
+		return r
 	}
 
-	if prescale == true {
-		topCrop.Min.X = int(chop(float64(topCrop.Min.X) / prescalefactor))
-		topCrop.Min.Y = int(chop(float64(topCrop.Min.Y) / prescalefactor))
-		topCrop.Max.X = int(chop(float64(topCrop.Max.X) / prescalefactor))
-		topCrop.Max.Y = int(chop(float64(topCrop.Max.Y) / prescalefactor))
+	var d image.Point
+	if r.Min.X > required.Min.X {
+		d.X = required.Min.X - r.Min.X
+	} else if r.Max.X < required.Max.X {
+		d.X = required.Max.X - r.Max.X
+	}
+	if r.Min.Y > required.Min.Y {
+		d.Y = required.Min.Y - r.Min.Y
+	} else if r.Max.Y < required.Max.Y {
+		d.Y = required.Max.Y - r.Max.Y
+	}
+	r = r.Add(d)
+
+	// stay inside the image
+	d = image.Point{}
+	if r.Min.X < bounds.Min.X {
+		d.X = bounds.Min.X - r.Min.X
+	} else if r.Max.X > bounds.Max.X {
+		d.X = bounds.Max.X - r.Max.X
+	}
+	if r.Min.Y < bounds.Min.Y {
+		d.Y = bounds.Min.Y - r.Min.Y
+	} else if r.Max.Y > bounds.Max.Y {
+		d.Y = bounds.Max.Y - r.Max.Y
 	}
 
-	return topCrop.Canon(), nil
+	return r.Add(d)
 }
 
-func (c Crop) totalScore() float64 {
-	return (c.Score.Detail*detailWeight + c.Score.Skin*skinWeight + c.Score.Saturation*saturationWeight + c.Score.Boost * boostWeight) / float64(c.Dx()) / float64(c.Dy())
+func (c Crop) totalScore(opts *Options) float64 {
+	return (c.Score.Detail*opts.DetailWeight + c.Score.Skin*opts.SkinWeight + c.Score.Saturation*opts.SaturationWeight + (c.Score.Boost-c.Score.Penalty)*opts.BoostWeight + c.Score.Extra) / float64(c.Dx()) / float64(c.Dy())
 }
 
 func chop(x float64) float64 {
@@ -224,37 +731,43 @@ func bounds(l float64) float64 {
 }
 
 // return ordinary importance and boost area importance
-func importance(crop Crop, x, y int) (float64, float64) {
+func importance(opts *Options, crop Crop, x, y int) (float64, float64) {
 	if crop.Min.X > x || x >= crop.Max.X || crop.Min.Y > y || y >= crop.Max.Y {
-		return outsideImportance, outsideImportance
+		return opts.OutsideImportance, opts.OutsideImportance
 	}
 
 	xf := float64(x-crop.Min.X) / float64(crop.Dx())
 	yf := float64(y-crop.Min.Y) / float64(crop.Dy())
 
+	return importanceAt(opts, xf, yf)
+}
+
+// importanceAt returns the importance inside a crop at the relative position
+// xf, yf (0..1)
+func importanceAt(opts *Options, xf, yf float64) (float64, float64) {
 	px := math.Abs(0.5-xf) * 2.0
 	py := math.Abs(0.5-yf) * 2.0
 
-	dx := math.Max(px-1.0+edgeRadius, 0.0)
-	dy := math.Max(py-1.0+edgeRadius, 0.0)
-	d := (dx*dx + dy*dy) * edgeWeight
+	dx := math.Max(px-1.0+opts.EdgeRadius, 0.0)
+	dy := math.Max(py-1.0+opts.EdgeRadius, 0.0)
+	d := (dx*dx + dy*dy) * opts.EdgeWeight
 
 	s := 1.414 - math.Sqrt(px*px+py*py)
 	// make a temp copy of s
 	sBoost := s
-	if ruleOfThirds {
+	if opts.RuleOfThirds {
 		s += (math.Max(0.0, s+d+0.5) * 1.2) * (thirds(px) + thirds(py))
 	}
 
 	return s + d, sBoost * 4
 }
 
-func score(sampleOutput *image.RGBA, crop Crop) Score {
-	width := sampleOutput.Bounds().Dx()
-	height := sampleOutput.Bounds().Dy()
+func score(opts *Options, sample *scoreMap, crop Crop) Score {
+	width := sample.detail.Width
+	height := sample.detail.Height
 	score := Score{}
 
-	downSample := scoreDownSample
+	downSample := opts.ScoreDownSample
 	invDownSample := float32(1) / float32(downSample)
 	outputHeightDownSample := height * downSample
 	outputWidthDownSample := width * downSample
@@ -264,134 +777,208 @@ func score(sampleOutput *image.RGBA, crop Crop) Score {
 			sy := int(float32(y) * invDownSample)
 			sx := int(float32(x) * invDownSample)
 
-			imp, impBoost := importance(crop, x, y)
+			imp, impBoost := importance(opts, crop, x, y)
 
-			c := sampleOutput.RGBAAt(sx, sy)
-			r8 := float64(c.R)
-			g8 := float64(c.G)
-			b8 := float64(c.B)
-			a8 := float64(c.A)
+			det := float64(sample.detail.At(sx, sy))
 
-			det := g8 / 255.0
-
-			score.Skin += r8 / 255.0 * (det + skinBias) * imp
+			score.Skin += float64(sample.skin.At(sx, sy)) * (det + opts.SkinBias) * imp
 			score.Detail += det * imp
-			score.Saturation += b8 / 255.0 * (det + saturationBias) * imp
-			score.Boost += (a8 / 255) * impBoost
+			score.Saturation += float64(sample.saturation.At(sx, sy)) * (det + opts.SaturationBias) * imp
+			score.Boost += float64(sample.boost.At(sx, sy)) * impBoost
+			if sample.extra != nil {
+				score.Extra += float64(sample.extra.At(sx, sy)) * imp
+			}
+
+			if sample.penalty != nil && image.Pt(x, y).In(crop.Rectangle) {
+				score.Penalty += float64(sample.penalty.At(sx, sy)) * penaltyImportance
+			}
 		}
 	}
 
 	return score
 }
 
-func downSample(input *image.RGBA, factor int) *image.RGBA {
-	width := input.Bounds().Dx()/factor
-	height := input.Bounds().Dy()/factor
-	output := image.NewRGBA(image.Rectangle{Min: image.Point{X:0,Y:0}, Max: image.Point{X:width, Y:height}})
-	ifactor2 := 1.0 / (float64(factor) * float64(factor))
-	for y := 0; y < height; y++ {
-		for x := 0; x < width; x++ {
-			// i := (y * width + x) * 4
-
-			r := uint8(0)
-			g := uint8(0)
-			b := uint8(0)
-			a := uint8(0)
-
-			mr := uint8(0)
-			mg := uint8(0)
-
-			for v := 0; v < factor; v++ {
-				for u := 0; u < factor; u++ {
-					//j := ((y * factor + v) * iwidth + (x * factor + u)) * 4;
-					iy := y * factor + v
-					ix := x * factor + u
-					c := input.RGBAAt(ix, iy)
-					r += c.R
-					g += c.G
-					b += c.B
-					a += c.A
-					if mr < c.R {
-						mr = c.R
-					}
-					if mg < c.G {
-						mg = c.G
-					}
-					// unused
-					//if mb < c.B {
-					//	mb = c.B
-					//}
-				}
-			}
-			// this is some funky magic to preserve detail a bit more for
-			// skin (r) and detail (g). Saturation (b) does not get this boost.
-			nc := color.RGBA{
-						R:uint8(bounds(float64(r) * ifactor2 * 0.5 + float64(mr) * 0.5)),
-						G:uint8(bounds(float64(g) * ifactor2 * 0.7 + float64(mg) * 0.3)),
-						B:uint8(bounds(float64(b) * ifactor2)),
-						A:uint8(bounds(float64(a) * ifactor2))}
-
-			output.SetRGBA(x, y, nc)
-		}
+// downSample reduces every plane of the feature map by ScoreDownSample
+func downSample(opts *Options, fm *FeatureMap) *scoreMap {
+	factor := opts.ScoreDownSample
+	sample := &scoreMap{
+		detail:     downSamplePlane(fm.Detail, factor, opts.DetailMaxRatio),
+		skin:       downSamplePlane(fm.Skin, factor, opts.SkinMaxRatio),
+		saturation: downSamplePlane(fm.Saturation, factor, opts.SaturationMaxRatio),
+		boost:      downSamplePlane(fm.Boost, factor, 0),
+	}
+	if fm.Penalty != nil {
+		sample.penalty = downSamplePlane(fm.Penalty, factor, 0)
+	}
+	if fm.Extra != nil {
+		sample.extra = downSamplePlane(fm.Extra, factor, 0)
 	}
 
-	return output
+	return sample
 }
 
-
-func analyse(logger Logger, img *image.RGBA, cropWidth, cropHeight, realMinScale float64, boosts []BoostRegion) (image.Rectangle, error) {
-	o := image.NewRGBA(img.Bounds())
-
+// scoreCrops scores all candidate crops and returns them ordered by descending
+// total score
+func scoreCrops(ctx context.Context, logger Logger, opts *Options, fm *FeatureMap, sample *scoreMap, cropWidth, cropHeight, realMinScale float64) ([]Crop, error) {
+	features := fm.Detail.Bounds()
+	// rounding outwards may reach past the prescaled image
+	required := prescaleRect(fm.Required.Sub(fm.Bounds.Min), fm.Prescale).Intersect(features)
 	now := time.Now()
-	edgeDetect(img, o)
-	logger.Log.Println("Time elapsed edge:", time.Since(now))
-	debugOutput(logger.DebugMode, o, "edge")
+	scoreFn := func(crop Crop) Score {
+		return score(opts, sample, crop)
+	}
+	if opts.IntegralScoring {
+		scoreFn = newIntegralScorer(opts, sample).score
+	}
+	logger.Log.Println("Time elapsed scorer:", time.Since(now))
+
+	scoreAll := func(cs []Crop) error {
+		return forEachCrop(ctx, opts, len(cs), func(idx int) {
+			nowIn := time.Now()
+			cs[idx].Score = scoreFn(cs[idx])
+			cs[idx].Score.Total = cs[idx].totalScore(opts)
+			logger.Log.Println("Time elapsed single-score:", time.Since(nowIn))
+		})
+	}
 
 	now = time.Now()
-	skinDetect(img, o)
-	logger.Log.Println("Time elapsed skin:", time.Since(now))
-	debugOutput(logger.DebugMode, o, "skin")
+	var cs []Crop
+	var err error
+	if opts.Search == SearchCoarseToFine {
+		cs, err = searchCoarseToFine(ctx, opts, features, cropWidth, cropHeight, realMinScale, required, scoreAll)
+	} else {
+		cs = crops(opts, features, cropWidth, cropHeight, realMinScale, required)
+		err = scoreAll(cs)
+	}
+	if err != nil {
+		return nil, err
+	}
+	logger.Log.Println("Time elapsed score:", time.Since(now), len(cs))
+
+	// a stable sort keeps the first of equally scored crops on top
+	sort.SliceStable(cs, func(i, j int) bool {
+		return cs[i].Score.Total > cs[j].Score.Total
+	})
+
+	if logger.DebugMode && len(cs) > 0 {
+		// draw on a copy, the feature map may be scored again
+		final := fm.Image()
+		drawDebugCrop(opts, cs[0], final, fm.Penalty)
+		debugOutput(true, final, "final")
+	}
 
-	now = time.Now()
-	saturationDetect(img, o)
-	logger.Log.Println("Time elapsed sat:", time.Since(now))
-	debugOutput(logger.DebugMode, o, "saturation")
+	return cs, nil
+}
 
-	now = time.Now()
-	applyBoosts(boosts, o)
-	logger.Log.Println("Time elapsed boost:", time.Since(now))
-	debugOutput(logger.DebugMode, o, "boost")
+// forEachCrop calls fn for every index from 0 to n-1, spread over a pool of
+// goroutines if ParallelScoring is enabled. It stops early and returns the
+// context's error once the context is done.
+func forEachCrop(ctx context.Context, opts *Options, n int, fn func(idx int)) error {
+	workers := 1
+	if opts.ParallelScoring {
+		workers = opts.Workers
+		if workers <= 0 {
+			workers = runtime.GOMAXPROCS(0)
+		}
+	}
+	if workers > n {
+		workers = n
+	}
 
+	if workers <= 1 {
+		for idx := 0; idx < n; idx++ {
+			if idx%cancelCheckInterval == 0 && ctx.Err() != nil {
+				return ctx.Err()
+			}
+			fn(idx)
+		}
+		return ctx.Err()
+	}
 
-	now = time.Now()
-	sampleOutput := downSample(o, scoreDownSample)
-	logger.Log.Println("Time elapsed downsample:", time.Since(now))
-	debugOutput(logger.DebugMode, sampleOutput, "downSample")
+	next := int64(-1)
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			for {
+				idx := int(atomic.AddInt64(&next, 1))
+				if idx >= n || (idx%cancelCheckInterval == 0 && ctx.Err() != nil) {
+					return
+				}
+				fn(idx)
+			}
+		}()
+	}
+	wg.Wait()
 
-	now = time.Now()
-	var topCrop Crop
-	topScore := -1.0
-	cs := crops(o, cropWidth, cropHeight, realMinScale)
-	logger.Log.Println("Time elapsed crops:", time.Since(now), len(cs))
+	return ctx.Err()
+}
 
-	now = time.Now()
+// suppressOverlaps walks the ordered crops and keeps at most n of them, skipping
+// every crop that overlaps an already kept one by more than the given
+// intersection over union ratio
+func suppressOverlaps(cs []Crop, n int, overlap float64) []Crop {
+	res := []Crop{}
 	for _, crop := range cs {
-		nowIn := time.Now()
-		crop.Score = score(sampleOutput, crop)
-		logger.Log.Println("Time elapsed single-score:", time.Since(nowIn))
-		if crop.totalScore() > topScore {
-			topCrop = crop
-			topScore = crop.totalScore()
+		if len(res) >= n {
+			break
+		}
+
+		keep := true
+		for _, kept := range res {
+			if IntersectionOverUnion(crop.Rectangle, kept.Rectangle) > overlap {
+				keep = false
+				break
+			}
+		}
+		if keep {
+			res = append(res, crop)
 		}
 	}
-	logger.Log.Println("Time elapsed score:", time.Since(now))
 
-	if logger.DebugMode {
-		drawDebugCrop(topCrop, o)
-		debugOutput(true, o, "final")
+	return res
+}
+
+// IntersectionOverUnion returns the area both rectangles share divided by the
+// area they cover together, 0 for disjoint and 1 for equal rectangles.
+func IntersectionOverUnion(a, b image.Rectangle) float64 {
+	i := a.Intersect(b)
+	if i.Empty() {
+		return 0
 	}
 
-	return topCrop.Rectangle, nil
+	ia := float64(i.Dx() * i.Dy())
+	return ia / (float64(a.Dx()*a.Dy()+b.Dx()*b.Dy()) - ia)
+}
+
+// ColorMath selects the color calculations of the feature detection
+type ColorMath int
+
+const (
+	// ColorMathCompat keeps the calculations of earlier versions, which work
+	// on gamma encoded sRGB and swap the red and blue luminance weights
+	ColorMathCompat ColorMath = iota
+	// ColorMathPerceptual uses CIELAB lightness and saturation, computed from
+	// linear light
+	ColorMathPerceptual
+)
+
+// lightness returns the lightness (0..1) of c
+func lightness(opts *Options, c color.RGBA) float64 {
+	if opts.ColorMath == ColorMathPerceptual {
+		l, _, _ := colormath.RGBToLab(c.R, c.G, c.B)
+		return l / 100.0
+	}
+	return cie(c) / 255.0
+}
+
+// colorSaturation returns the saturation (0..1) of c
+func colorSaturation(opts *Options, c color.RGBA) float64 {
+	if opts.ColorMath == ColorMathPerceptual {
+		return colormath.LabSaturation(colormath.RGBToLab(c.R, c.G, c.B))
+	}
+	return saturation(c)
 }
 
 func saturation(c color.RGBA) float64 {
@@ -435,26 +1022,35 @@ func cie(c color.RGBA) float64 {
 	return 0.5126*float64(c.B) + 0.7152*float64(c.G) + 0.0722*float64(c.R)
 }
 
-func skinCol(c color.RGBA) float64 {
+// skinCol returns the similarity of c to the closest of the skin colors
+func skinCol(skinColors [][3]float64, c color.RGBA) float64 {
 	r8, g8, b8 := float64(c.R), float64(c.G), float64(c.B)
 
 	mag := math.Sqrt(r8*r8 + g8*g8 + b8*b8)
-	rd := r8/mag - skinColor[0]
-	gd := g8/mag - skinColor[1]
-	bd := b8/mag - skinColor[2]
+	if mag == 0 {
+		return 0
+	}
 
-	d := math.Sqrt(rd*rd + gd*gd + bd*bd)
-	return 1.0 - d
+	similarity := 0.0
+	for _, skinColor := range skinColors {
+		rd := r8/mag - skinColor[0]
+		gd := g8/mag - skinColor[1]
+		bd := b8/mag - skinColor[2]
+
+		d := math.Sqrt(rd*rd + gd*gd + bd*bd)
+		similarity = math.Max(similarity, 1.0-d)
+	}
+	return similarity
 }
 
-func makeCies(img *image.RGBA) []float64 {
+func makeCies(opts *Options, img *image.RGBA) []float64 {
 	width := img.Bounds().Dx()
 	height := img.Bounds().Dy()
 	cies := make([]float64, width*height, width*height)
 	i := 0
 	for y := 0; y < height; y++ {
 		for x := 0; x < width; x++ {
-			cies[i] = cie(img.RGBAAt(x, y))
+			cies[i] = lightness(opts, img.RGBAAt(x, y)) * 255.0
 			i++
 		}
 	}
@@ -462,102 +1058,121 @@ func makeCies(img *image.RGBA) []float64 {
 	return cies
 }
 
-func edgeDetect(i *image.RGBA, o *image.RGBA) {
+// chroma reports whether the CIELAB chroma of c reaches SkinChromaMin
+func chroma(opts *Options, c color.RGBA) bool {
+	if opts.SkinChromaMin <= 0 {
+		return true
+	}
+	_, a, b := colormath.RGBToLab(c.R, c.G, c.B)
+	return math.Hypot(a, b) >= opts.SkinChromaMin
+}
+
+func skinDetect(opts *Options, i *image.RGBA) *Plane {
 	width := i.Bounds().Dx()
 	height := i.Bounds().Dy()
-	cies := makeCies(i)
+	o := NewPlane(width, height)
 
-	var lightness float64
 	for y := 0; y < height; y++ {
 		for x := 0; x < width; x++ {
-			if x == 0 || x >= width-1 || y == 0 || y >= height-1 {
-				lightness = cie(i.RGBAAt(x, y))
-			} else {
-				lightness = cies[y*width+x]*4.0 -
-					cies[x+(y-1)*width] -
-					cies[x-1+y*width] -
-					cies[x+1+y*width] -
-					cies[x+(y+1)*width]
-			}
+			c := i.RGBAAt(i.Bounds().Min.X+x, i.Bounds().Min.Y+y)
+			lightness := lightness(opts, c)
+			skin := skinCol(opts.SkinColors, c)
 
-			nc := color.RGBA{0, uint8(bounds(lightness)), 0, 0}
-			o.SetRGBA(x, y, nc)
+			if skin > opts.SkinThreshold && lightness >= opts.SkinBrightnessMin && lightness <= opts.SkinBrightnessMax && chroma(opts, c) {
+				o.Set(x, y, float32((skin-opts.SkinThreshold)/(1.0-opts.SkinThreshold)))
+			}
 		}
 	}
+
+	return o
 }
 
-func skinDetect(i *image.RGBA, o *image.RGBA) {
+func saturationDetect(opts *Options, i *image.RGBA) *Plane {
 	width := i.Bounds().Dx()
 	height := i.Bounds().Dy()
+	o := NewPlane(width, height)
 
 	for y := 0; y < height; y++ {
 		for x := 0; x < width; x++ {
-			lightness := cie(i.RGBAAt(x, y)) / 255.0
-			skin := skinCol(i.RGBAAt(x, y))
-
-			c := o.RGBAAt(x, y)
-			if skin > skinThreshold && lightness >= skinBrightnessMin && lightness <= skinBrightnessMax {
-				r := (skin - skinThreshold) * (255.0 / (1.0 - skinThreshold))
-				nc := color.RGBA{uint8(bounds(r)), c.G, c.B, 0}
-				o.SetRGBA(x, y, nc)
-			} else {
-				nc := color.RGBA{0, c.G, c.B, 0}
-				o.SetRGBA(x, y, nc)
+			c := i.RGBAAt(i.Bounds().Min.X+x, i.Bounds().Min.Y+y)
+			lightness := lightness(opts, c)
+			saturation := colorSaturation(opts, c)
+
+			if saturation > opts.SaturationThreshold && lightness >= opts.SaturationBrightnessMin && lightness <= opts.SaturationBrightnessMax {
+				o.Set(x, y, float32((saturation-opts.SaturationThreshold)/(1.0-opts.SaturationThreshold)))
 			}
 		}
 	}
-}
 
-func saturationDetect(i *image.RGBA, o *image.RGBA) {
-	width := i.Bounds().Dx()
-	height := i.Bounds().Dy()
+	return o
+}
 
-	for y := 0; y < height; y++ {
-		for x := 0; x < width; x++ {
-			lightness := cie(i.RGBAAt(x, y)) / 255.0
-			saturation := saturation(i.RGBAAt(x, y))
-
-			c := o.RGBAAt(x, y)
-			if saturation > saturationThreshold && lightness >= saturationBrightnessMin && lightness <= saturationBrightnessMax {
-				b := (saturation - saturationThreshold) * (255.0 / (1.0 - saturationThreshold))
-				nc := color.RGBA{c.R, c.G, uint8(bounds(b)), 0}
-				o.SetRGBA(x, y, nc)
-			} else {
-				nc := color.RGBA{c.R, c.G, 0, 0}
-				o.SetRGBA(x, y, nc)
+// applyBoosts paints the boost regions into a boost plane. Regions with a
+// negative weight go into the returned penalty plane instead, which is nil if
+// there are none.
+func applyBoosts(boosts []BoostRegion, width, height int) (*Plane, *Plane) {
+	boost := NewPlane(width, height)
+	var penalty *Plane
+	for _, b := range boosts {
+		if b.Weight < 0 {
+			if penalty == nil {
+				penalty = NewPlane(width, height)
 			}
+			applyPenalty(b, penalty)
+		} else if b.Weight > 0 {
+			// regions without a weight, like plain required regions, must
+			// not erase the boosts they overlap
+			applyBoost(b, boost)
 		}
 	}
+
+	return boost, penalty
 }
 
-func applyBoosts(boosts []BoostRegion, o *image.RGBA) {
-	for _, boost :=  range boosts {
-		applyBoost(boost, o)
-	}
+// Rect returns the region's rectangle.
+func (boost BoostRegion) Rect() image.Rectangle {
+	return image.Rect(boost.X, boost.Y, boost.X+boost.Width, boost.Y+boost.Height)
+}
+
+// applyBoost paints the region into the boost plane, clipped to the plane
+func applyBoost(boost BoostRegion, o *Plane) {
+	paintRegion(boost, o, boost.Weight)
 }
 
-func applyBoost(boost BoostRegion, o *image.RGBA) {
-	var x0 = boost.X
-	var x1 = boost.X + boost.Width
-	var y0 = boost.Y
-	var y1 = boost.Y + boost.Height
-	var weight = uint8(bounds(boost.Weight * 255.0))
+// applyPenalty paints the region into the penalty plane, clipped to the plane
+func applyPenalty(boost BoostRegion, o *Plane) {
+	paintRegion(boost, o, -boost.Weight)
+}
+
+func paintRegion(boost BoostRegion, o *Plane, weight float64) {
+	r := boost.Rect().Intersect(o.Bounds())
+	var x0 = r.Min.X
+	var x1 = r.Max.X
+	var y0 = r.Min.Y
+	var y1 = r.Max.Y
+	weight = math.Min(math.Max(weight, 0), 1)
 
 	for y := y0; y < y1; y++ {
 		for x := x0; x < x1; x++ {
-			c := o.RGBAAt(x, y)
-			nc := color.RGBA{c.R, c.G, c.B, weight}
-			o.SetRGBA(x, y, nc)
+			cov := boost.coverage(x, y)
+			if cov == 0 {
+				continue
+			}
+
+			// faded edges never lower the weight of overlapping regions
+			v := float32(weight * cov)
+			if cov < 1 && v < o.At(x, y) {
+				continue
+			}
+			o.Set(x, y, v)
 		}
 	}
 }
 
-func crops(i image.Image, cropWidth, cropHeight, realMinScale float64) []Crop {
-	res := []Crop{}
-	width := i.Bounds().Dx()
-	height := i.Bounds().Dy()
-
-	minDimension := math.Min(float64(width), float64(height))
+// cropSize returns the crop size at scale 1.0, falling back to the smaller
+// image dimension if a dimension isn't given
+func cropSize(bounds image.Rectangle, cropWidth, cropHeight float64) (float64, float64) {
+	minDimension := math.Min(float64(bounds.Dx()), float64(bounds.Dy()))
 	var cropW, cropH float64
 
 	if cropWidth != 0.0 {
@@ -571,9 +1186,86 @@ func crops(i image.Image, cropWidth, cropHeight, realMinScale float64) []Crop {
 		cropH = minDimension
 	}
 
-	for scale := maxScale; scale >= realMinScale; scale -= scaleStep {
-		for y := 0; float64(y)+cropH*scale <= float64(height); y += step {
-			for x := 0; float64(x)+cropW*scale <= float64(width); x += step {
+	return cropW, cropH
+}
+
+// prescaleRect scales a rectangle, rounding outwards
+func prescaleRect(r image.Rectangle, f float64) image.Rectangle {
+	if r.Empty() {
+		return image.Rectangle{}
+	}
+
+	return image.Rect(
+		int(math.Floor(float64(r.Min.X)*f)),
+		int(math.Floor(float64(r.Min.Y)*f)),
+		int(math.Ceil(float64(r.Max.X)*f)),
+		int(math.Ceil(float64(r.Max.Y)*f)))
+}
+
+// feasibleOrigins returns the range of top left corners of w x h crops inside
+// a width x height image that contain the required rectangle
+func feasibleOrigins(required image.Rectangle, w, h, width, height int) (image.Rectangle, bool) {
+	origins := image.Rect(0, 0, width-w, height-h)
+	if !required.Empty() {
+		origins.Min.X = max(origins.Min.X, required.Max.X-w)
+		origins.Min.Y = max(origins.Min.Y, required.Max.Y-h)
+		origins.Max.X = min(origins.Max.X, required.Min.X)
+		origins.Max.Y = min(origins.Max.Y, required.Min.Y)
+	}
+
+	return origins, origins.Min.X <= origins.Max.X && origins.Min.Y <= origins.Max.Y
+}
+
+// steps returns lo, lo+step, ... up to and including hi
+func steps(lo, hi, step int) []int {
+	res := []int{}
+	for v := lo; v < hi; v += step {
+		res = append(res, v)
+	}
+	return append(res, hi)
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// crops returns the candidate crops. If the required rectangle isn't empty,
+// only crops containing it are returned.
+func crops(opts *Options, bounds image.Rectangle, cropWidth, cropHeight, realMinScale float64, required image.Rectangle) []Crop {
+	res := []Crop{}
+	width := bounds.Dx()
+	height := bounds.Dy()
+	cropW, cropH := cropSize(bounds, cropWidth, cropHeight)
+
+	for scale := opts.MaxScale; scale >= realMinScale; scale -= opts.ScaleStep {
+		if !required.Empty() {
+			// walk the feasible origins only, including the last one, so
+			// narrow ranges don't get skipped by the grid
+			w, h := int(cropW*scale), int(cropH*scale)
+			origins, ok := feasibleOrigins(required, w, h, width, height)
+			if !ok {
+				continue
+			}
+			for _, y := range steps(origins.Min.Y, origins.Max.Y, opts.Step) {
+				for _, x := range steps(origins.Min.X, origins.Max.X, opts.Step) {
+					res = append(res, Crop{Rectangle: image.Rect(x, y, x+w, y+h)})
+				}
+			}
+			continue
+		}
+
+		for y := 0; float64(y)+cropH*scale <= float64(height); y += opts.Step {
+			for x := 0; float64(x)+cropW*scale <= float64(width); x += opts.Step {
 				res = append(res, Crop{
 					Rectangle: image.Rect(x, y, x+int(cropW*scale), y+int(cropH*scale)),
 				})
@@ -591,10 +1283,19 @@ func ToRGBA(img image.Image) *image.RGBA {
 		return img.(*image.RGBA)
 	}
 	out := image.NewRGBA(img.Bounds())
-	draw.Copy(out, image.Pt(0, 0), img, img.Bounds(), draw.Src, nil)
+	draw.Copy(out, img.Bounds().Min, img, img.Bounds(), draw.Src, nil)
 	return out
 }
 
+// rebase returns the image moved to the origin, sharing its pixels
+func rebase(img *image.RGBA) *image.RGBA {
+	if img.Rect.Min == (image.Point{}) {
+		return img
+	}
+
+	return &image.RGBA{Pix: img.Pix, Stride: img.Stride, Rect: img.Rect.Sub(img.Rect.Min)}
+}
+
 func CombineImage(images []*image.RGBA) *image.RGBA {
 	newY := 0
 	totalX := 0
@@ -607,8 +1308,8 @@ func CombineImage(images []*image.RGBA) *image.RGBA {
 	}
 
 	newRect := image.Rectangle{
-		Min: image.Point{X:0, Y:0},
-		Max: image.Point{X:totalX, Y:newY},
+		Min: image.Point{X: 0, Y: 0},
+		Max: image.Point{X: totalX, Y: newY},
 	}
 
 	newImage := image.NewRGBA(newRect)
@@ -620,7 +1321,7 @@ func CombineImage(images []*image.RGBA) *image.RGBA {
 		if rect.Max.Y == newY {
 			draw.Copy(newImage, image.Pt(startX, 0), img, img.Bounds(), draw.Src, nil)
 		} else {
-			draw.Copy(newImage, image.Pt(startX, newY - rect.Max.Y), img, img.Bounds(), draw.Src, nil)
+			draw.Copy(newImage, image.Pt(startX, newY-rect.Max.Y), img, img.Bounds(), draw.Src, nil)
 		}
 		startX = startX + rect.Max.X
 	}
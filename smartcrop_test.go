@@ -28,17 +28,22 @@
 package smartcrop
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"image"
+	"image/color"
 	_ "image/jpeg"
 	_ "image/png"
 	"io/ioutil"
 	"os"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/muesli/smartcrop/nfnt"
+
+	"golang.org/x/image/draw"
 )
 
 var (
@@ -55,6 +60,22 @@ type SubImager interface {
 	SubImage(r image.Rectangle) image.Image
 }
 
+// loadTestImage decodes the image file, failing the test on errors
+func loadTestImage(t testing.TB, path string) image.Image {
+	t.Helper()
+	fi, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fi.Close()
+
+	img, _, err := image.Decode(fi)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return img
+}
+
 func TestCrop(t *testing.T) {
 	fi, _ := os.Open(testFile)
 	defer fi.Close()
@@ -103,6 +124,20 @@ func BenchmarkCrop(b *testing.B) {
 	}
 }
 
+func BenchmarkCropIntegral(b *testing.B) {
+	img := loadTestImage(b, testFile)
+
+	opts := DefaultOptions()
+	opts.IntegralScoring = true
+	analyzer := NewAnalyzerWithOptions(nfnt.NewDefaultResizer(), Logger{}, opts)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := analyzer.FindBestCrop(img, 250, 250, nil); err != nil {
+			b.Error(err)
+		}
+	}
+}
+
 func BenchmarkEdge(b *testing.B) {
 	fi, err := os.Open(testFile)
 	if err != nil {
@@ -116,10 +151,28 @@ func BenchmarkEdge(b *testing.B) {
 	}
 
 	rgbaImg := ToRGBA(img)
+	opts := DefaultOptions()
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		o := image.NewRGBA(img.Bounds())
-		edgeDetect(rgbaImg, o)
+		edgeDetect(&opts, rgbaImg)
+	}
+}
+
+func BenchmarkEdgeOperators(b *testing.B) {
+	img := loadTestImage(b, testFile)
+
+	rgbaImg := ToRGBA(img)
+	for _, tt := range edgeOperators {
+		for _, scales := range []int{1, 3} {
+			opts := DefaultOptions()
+			opts.EdgeOperator = tt.op
+			opts.EdgeScales = scales
+			b.Run(fmt.Sprintf("%s-%d", tt.name, scales), func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					edgeDetect(&opts, rgbaImg)
+				}
+			})
+		}
 	}
 }
 
@@ -160,3 +213,367 @@ func BenchmarkImageDir(b *testing.B) {
 	}
 	// fmt.Println("average time/image:", b.t)
 }
+
+func TestCropWithOptions(t *testing.T) {
+	img := loadTestImage(t, testFile)
+
+	analyzer := NewAnalyzerWithOptions(nfnt.NewDefaultResizer(), Logger{}, DefaultOptions())
+	topCrop, err := analyzer.FindBestCrop(img, 250, 250, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := image.Rect(115, 0, 399, 284)
+	if topCrop != expected {
+		t.Fatalf("expected %v, got %v", expected, topCrop)
+	}
+
+	opts := DefaultOptions()
+	opts.Step = 0
+	analyzer = NewAnalyzerWithOptions(nfnt.NewDefaultResizer(), Logger{}, opts)
+	if _, err := analyzer.FindBestCrop(img, 250, 250, nil); err != ErrInvalidOptions {
+		t.Fatalf("expected %v, got %v", ErrInvalidOptions, err)
+	}
+}
+
+func TestCropWithScore(t *testing.T) {
+	img := loadTestImage(t, testFile)
+
+	analyzer := NewAnalyzerWithOptions(nfnt.NewDefaultResizer(), Logger{}, DefaultOptions())
+	topCrop, err := analyzer.FindBestCropWithScore(img, 250, 250, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := image.Rect(115, 0, 399, 284)
+	if topCrop.Rectangle != expected {
+		t.Fatalf("expected %v, got %v", expected, topCrop.Rectangle)
+	}
+	if topCrop.Score.Total <= 0 {
+		t.Errorf("expected a positive total score, got %f", topCrop.Score.Total)
+	}
+	if topCrop.Score.Detail == 0 || topCrop.Score.Saturation == 0 {
+		t.Errorf("expected detail and saturation scores, got %+v", topCrop.Score)
+	}
+}
+
+func TestTopCrops(t *testing.T) {
+	img := loadTestImage(t, testFile)
+
+	analyzer := NewAnalyzerWithOptions(nfnt.NewDefaultResizer(), Logger{}, DefaultOptions())
+	topCrops, err := analyzer.FindTopCrops(img, 250, 250, nil, 3, 0.5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(topCrops) != 3 {
+		t.Fatalf("expected 3 crops, got %d", len(topCrops))
+	}
+	expected := image.Rect(115, 0, 399, 284)
+	if topCrops[0].Rectangle != expected {
+		t.Fatalf("expected %v, got %v", expected, topCrops[0].Rectangle)
+	}
+
+	for i := range topCrops {
+		if i > 0 && topCrops[i].Score.Total > topCrops[i-1].Score.Total {
+			t.Errorf("crops not ordered by score: %+v", topCrops)
+		}
+		for j := i + 1; j < len(topCrops); j++ {
+			if iou := IntersectionOverUnion(topCrops[i].Rectangle, topCrops[j].Rectangle); iou > 0.5 {
+				t.Errorf("crops %v and %v overlap by %f", topCrops[i].Rectangle, topCrops[j].Rectangle, iou)
+			}
+		}
+	}
+}
+
+func TestBestCrops(t *testing.T) {
+	img := loadTestImage(t, testFile)
+
+	sizes := []image.Point{{250, 250}, {4, 3}, {16, 9}, {9, 16}}
+	analyzer := NewAnalyzerWithOptions(nfnt.NewDefaultResizer(), Logger{}, DefaultOptions())
+	topCrops, err := analyzer.FindBestCrops(img, sizes, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(topCrops) != len(sizes) {
+		t.Fatalf("expected %d crops, got %d", len(sizes), len(topCrops))
+	}
+
+	for idx, size := range sizes {
+		expected, err := analyzer.FindBestCropWithScore(img, size.X, size.Y, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if topCrops[idx] != expected {
+			t.Errorf("size %v: expected %+v, got %+v", size, expected, topCrops[idx])
+		}
+	}
+
+	if _, err := analyzer.FindBestCrops(img, []image.Point{{1, 1}, {}}, nil); err != ErrInvalidDimensions {
+		t.Errorf("expected %v, got %v", ErrInvalidDimensions, err)
+	}
+}
+
+func BenchmarkBestCrops(b *testing.B) {
+	img := loadTestImage(b, testFile)
+
+	sizes := []image.Point{{1, 1}, {4, 3}, {16, 9}, {9, 16}}
+	analyzer := NewAnalyzerWithOptions(nfnt.NewDefaultResizer(), Logger{}, DefaultOptions())
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := analyzer.FindBestCrops(img, sizes, nil); err != nil {
+			b.Error(err)
+		}
+	}
+}
+
+func TestParallelScoring(t *testing.T) {
+	img := loadTestImage(t, testFile)
+
+	opts := DefaultOptions()
+	opts.MinScale = 0.7
+	serial, err := NewAnalyzerWithOptions(nfnt.NewDefaultResizer(), Logger{}, opts).FindTopCrops(img, 250, 250, nil, 1000, 1.0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opts.ParallelScoring = true
+	opts.Workers = 3
+	parallel, err := NewAnalyzerWithOptions(nfnt.NewDefaultResizer(), Logger{}, opts).FindTopCrops(img, 250, 250, nil, 1000, 1.0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(serial) != len(parallel) {
+		t.Fatalf("expected %d crops, got %d", len(serial), len(parallel))
+	}
+	for idx := range serial {
+		if serial[idx] != parallel[idx] {
+			t.Fatalf("crop %d: expected %+v, got %+v", idx, serial[idx], parallel[idx])
+		}
+	}
+}
+
+func BenchmarkCropParallel(b *testing.B) {
+	img := loadTestImage(b, testFile)
+
+	opts := DefaultOptions()
+	opts.ParallelScoring = true
+	analyzer := NewAnalyzerWithOptions(nfnt.NewDefaultResizer(), Logger{}, opts)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := analyzer.FindBestCrop(img, 250, 250, nil); err != nil {
+			b.Error(err)
+		}
+	}
+}
+
+func TestCropContext(t *testing.T) {
+	img := loadTestImage(t, testFile)
+
+	analyzer := NewAnalyzerWithOptions(nfnt.NewDefaultResizer(), Logger{}, DefaultOptions())
+	topCrop, err := analyzer.FindBestCropContext(context.Background(), img, 250, 250, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := image.Rect(115, 0, 399, 284)
+	if topCrop != expected {
+		t.Fatalf("expected %v, got %v", expected, topCrop)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := analyzer.FindBestCropContext(ctx, img, 250, 250, nil); err != context.Canceled {
+		t.Errorf("expected %v, got %v", context.Canceled, err)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), time.Nanosecond)
+	defer cancel()
+	time.Sleep(time.Millisecond)
+	if _, err := analyzer.FindBestCropContext(ctx, img, 250, 250, nil); err != context.DeadlineExceeded {
+		t.Errorf("expected %v, got %v", context.DeadlineExceeded, err)
+	}
+}
+
+func TestPenaltyRegion(t *testing.T) {
+	img := loadTestImage(t, testFile)
+
+	penalty := image.Rect(150, 100, 250, 200)
+	for _, integral := range []bool{false, true} {
+		opts := DefaultOptions()
+		opts.IntegralScoring = integral
+		analyzer := NewAnalyzerWithOptions(nfnt.NewDefaultResizer(), Logger{}, opts)
+
+		boosts := []BoostRegion{{X: penalty.Min.X, Y: penalty.Min.Y, Width: penalty.Dx(), Height: penalty.Dy(), Weight: -1.0}}
+		topCrop, err := analyzer.FindBestCropWithScore(img, 250, 250, boosts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if topCrop.Overlaps(penalty) {
+			t.Errorf("expected crop %v to leave out %v", topCrop.Rectangle, penalty)
+		}
+		if topCrop.Score.Penalty != 0 {
+			t.Errorf("expected no penalty, got %f", topCrop.Score.Penalty)
+		}
+	}
+}
+
+func TestRequiredRegion(t *testing.T) {
+	img := loadTestImage(t, testFile)
+
+	required := image.Rect(700, 50, 780, 120)
+	for _, search := range []SearchStrategy{SearchExhaustive, SearchCoarseToFine} {
+		opts := DefaultOptions()
+		opts.Search = search
+		analyzer := NewAnalyzerWithOptions(nfnt.NewDefaultResizer(), Logger{}, opts)
+
+		boosts := []BoostRegion{{X: required.Min.X, Y: required.Min.Y, Width: required.Dx(), Height: required.Dy(), Required: true}}
+		topCrop, err := analyzer.FindBestCrop(img, 250, 250, boosts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !required.In(topCrop) {
+			t.Errorf("expected crop %v to contain %v", topCrop, required)
+		}
+	}
+
+	// no square crop can contain the full width of the image
+	analyzer := NewAnalyzer(nfnt.NewDefaultResizer())
+	boosts := []BoostRegion{{X: 0, Y: 0, Width: 900, Height: 50, Required: true}}
+	_, err := analyzer.FindBestCrop(img, 250, 250, boosts)
+	if err != ErrNoFeasibleCrop {
+		t.Errorf("expected ErrNoFeasibleCrop, got %v", err)
+	}
+
+	// a required region keeps the boosts it overlaps
+	boost, _ := applyBoosts([]BoostRegion{
+		{X: 10, Y: 10, Width: 20, Height: 20, Weight: 1.0},
+		{X: 0, Y: 0, Width: 40, Height: 40, Required: true},
+	}, 50, 50)
+	if v := boost.At(20, 20); v != 1 {
+		t.Errorf("expected the boost under the required region to stay 1, got %f", v)
+	}
+}
+
+func TestBoostRegions(t *testing.T) {
+	img := loadTestImage(t, testFile)
+
+	analyzer := NewAnalyzer(nfnt.NewDefaultResizer())
+
+	// the boosts must not get rescaled in place
+	boosts := []BoostRegion{{X: 600, Y: 100, Width: 200, Height: 100, Weight: 1.0}}
+	first, err := analyzer.FindBestCrop(img, 250, 250, boosts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := analyzer.FindBestCrop(img, 250, 250, boosts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first != second {
+		t.Errorf("expected repeated calls to return %v, got %v", first, second)
+	}
+	if boosts[0] != (BoostRegion{X: 600, Y: 100, Width: 200, Height: 100, Weight: 1.0}) {
+		t.Errorf("expected the boosts to stay unchanged, got %+v", boosts[0])
+	}
+
+	// regions reaching past the image get clipped
+	clipped, err := analyzer.FindBestCrop(img, 250, 250, []BoostRegion{{X: 600, Y: -100, Width: 500, Height: 300, Weight: 1.0}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, err := analyzer.FindBestCrop(img, 250, 250, []BoostRegion{{X: 600, Y: 0, Width: 300, Height: 200, Weight: 1.0}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if clipped != expected {
+		t.Errorf("expected %v, got %v", expected, clipped)
+	}
+	required := image.Rect(800, 50, 950, 100)
+	topCrop, err := analyzer.FindBestCrop(img, 250, 250, []BoostRegion{{X: required.Min.X, Y: required.Min.Y, Width: required.Dx(), Height: required.Dy(), Required: true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !required.Intersect(img.Bounds()).In(topCrop) {
+		t.Errorf("expected crop %v to contain the visible part of %v", topCrop, required)
+	}
+
+	for _, boost := range []BoostRegion{{X: 10, Y: 10, Width: 0, Height: 10}, {X: 10, Y: 10, Width: 10, Height: -10}} {
+		_, err := analyzer.FindBestCrop(img, 250, 250, []BoostRegion{{X: 0, Y: 0, Width: 10, Height: 10}, boost})
+		if berr, ok := err.(*BoostRegionError); !ok || berr.Index != 1 {
+			t.Errorf("expected a BoostRegionError for region 1, got %v", err)
+		}
+	}
+}
+
+func TestCropOrigin(t *testing.T) {
+	img := loadTestImage(t, testFile)
+	rgba := ToRGBA(img)
+	analyzer := NewAnalyzer(nfnt.NewDefaultResizer())
+
+	// a sub-image has to give the same results as a copy of it at the origin
+	sub := rgba.SubImage(image.Rect(100, 20, 800, 284))
+	copied := image.NewRGBA(image.Rect(0, 0, 700, 264))
+	draw.Copy(copied, image.Point{}, sub, sub.Bounds(), draw.Src, nil)
+
+	boosts := []BoostRegion{{X: 500, Y: 150, Width: 100, Height: 100, Weight: 1.0}}
+	expected, err := analyzer.FindBestCrop(copied, 250, 250, boosts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	offset := image.Pt(100, 20)
+	topCrop, err := analyzer.FindBestCrop(sub, 250, 250, []BoostRegion{{X: 600, Y: 170, Width: 100, Height: 100, Weight: 1.0}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if topCrop != expected.Add(offset) {
+		t.Errorf("expected %v, got %v", expected.Add(offset), topCrop)
+	}
+
+	// the same goes for images with negative coordinates
+	offset = image.Pt(-50, -30)
+	moved := image.NewRGBA(copied.Bounds().Add(offset))
+	draw.Copy(moved, moved.Bounds().Min, copied, copied.Bounds(), draw.Src, nil)
+	topCrop, err = analyzer.FindBestCrop(moved, 250, 250, []BoostRegion{{X: 450, Y: 120, Width: 100, Height: 100, Weight: 1.0}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if topCrop != expected.Add(offset) {
+		t.Errorf("expected %v, got %v", expected.Add(offset), topCrop)
+	}
+
+	required := image.Rect(-40, -20, 60, 80)
+	topCrop, err = analyzer.FindBestCrop(moved, 250, 250, []BoostRegion{{X: required.Min.X, Y: required.Min.Y, Width: required.Dx(), Height: required.Dy(), Required: true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !required.In(topCrop) || !topCrop.In(moved.Bounds()) {
+		t.Errorf("expected crop %v inside %v to contain %v", topCrop, moved.Bounds(), required)
+	}
+}
+
+func TestColorMath(t *testing.T) {
+	compat := DefaultOptions()
+	perceptual := DefaultOptions()
+	perceptual.ColorMath = ColorMathPerceptual
+
+	red := color.RGBA{255, 0, 0, 255}
+	blue := color.RGBA{0, 0, 255, 255}
+	if lightness(&compat, blue) <= lightness(&compat, red) {
+		t.Errorf("expected the compatibility mode to keep the swapped weights")
+	}
+	if lightness(&perceptual, red) <= lightness(&perceptual, blue) {
+		t.Errorf("expected red to be lighter than blue")
+	}
+	gray := color.RGBA{128, 128, 128, 255}
+	if s := colorSaturation(&perceptual, gray); s > 1e-6 {
+		t.Errorf("expected gray to be unsaturated, got %f", s)
+	}
+
+	img := loadTestImage(t, testFile)
+	analyzer := NewAnalyzerWithOptions(nfnt.NewDefaultResizer(), Logger{}, perceptual)
+	topCrop, err := analyzer.FindBestCrop(img, 250, 250, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !topCrop.In(img.Bounds()) || topCrop.Dx() != topCrop.Dy() {
+		t.Errorf("expected a square crop inside the image, got %v", topCrop)
+	}
+}